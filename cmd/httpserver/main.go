@@ -1,191 +1,100 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"fmt"
+	"context"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/KDT2006/go-http/internal/accesslog"
+	"github.com/KDT2006/go-http/internal/compress"
+	"github.com/KDT2006/go-http/internal/fileserver"
 	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/proxy"
 	"github.com/KDT2006/go-http/internal/request"
 	"github.com/KDT2006/go-http/internal/response"
 	"github.com/KDT2006/go-http/internal/server"
+	"github.com/KDT2006/go-http/internal/tracing"
+	"github.com/KDT2006/go-http/internal/tracing/otlp"
 )
 
 const port = 42069
 
 func main() {
+	// Static files served from ./assets
+	assets := fileserver.Dir("assets")
+	serveAssets := fileserver.New(assets, fileserver.Options{
+		Prefix:  "/assets/",
+		Listing: true,
+	})
+
+	// Reverse proxy to httpbin.org
+	httpbin, err := proxy.New("https://httpbin.org", proxy.Options{
+		StripPrefix: "/httpbin",
+	})
+	if err != nil {
+		log.Fatalf("error: proxy.New() failed: %v", err)
+	}
+
+	// Explicit proxy for absolute-form and CONNECT requests, only to ports 80 and 443
+	// and never to internal addresses. It's off unless FORWARD_PROXY=1, which needs
+	// PROXY_USERNAME and PROXY_PASSWORD or a comma separated PROXY_ALLOWED_HOSTS
+	var forward *proxy.ForwardProxy
+	if os.Getenv("FORWARD_PROXY") == "1" {
+		var allowedHosts []string
+		for _, host := range strings.Split(os.Getenv("PROXY_ALLOWED_HOSTS"), ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				allowedHosts = append(allowedHosts, host)
+			}
+		}
+		forward, err = proxy.NewForward(proxy.ForwardOptions{
+			Username:     os.Getenv("PROXY_USERNAME"),
+			Password:     os.Getenv("PROXY_PASSWORD"),
+			AllowedHosts: allowedHosts,
+		})
+		if err != nil {
+			log.Fatalf("error: proxy.NewForward() failed: %v", err)
+		}
+	}
+
 	// Custom Handler func
-	customHandlerFunc := func(w *response.Writer, req *request.Request) *server.HandleError {
+	customHandlerFunc := func(w *response.Writer, req *request.Request) error {
 		target := req.RequestLine.RequestTarget
 		switch {
+		case proxy.IsProxyRequest(req):
+			if forward == nil {
+				return &server.HandleError{StatusCode: response.Forbidden, Message: "Forward proxying is disabled."}
+			}
+			return forward.Handle(w, req)
+
+		// Errors are rendered as HTML, JSON or plain text depending on Accept
 		case target == "/yourproblem":
-			content := `<html>
-  <head>
-    <title>400 Bad Request</title>
-  </head>
-  <body>
-    <h1>Bad Request</h1>
-    <p>Your request honestly kinda sucked.</p>
-  </body>
-</html>`
-			w.Headers = response.GetDefaultHeaders(len(content))
-			w.Headers.Replace("Content-Type", "text/html; charset=utf-8")
-			w.Status = response.BadRequest
-			w.Body = []byte(content)
 			return &server.HandleError{
 				StatusCode: response.BadRequest,
-				Message:    content,
+				Message:    "Your request honestly kinda sucked.",
 			}
 		case target == "/myproblem":
-			content := `<html>
-  <head>
-    <title>500 Internal Server Error</title>
-  </head>
-  <body>
-    <h1>Internal Server Error</h1>
-    <p>Okay, you know what? This one is on me.</p>
-  </body>
-</html>`
-			w.Headers = response.GetDefaultHeaders(len(content))
-			w.Headers.Replace("Content-Type", "text/html; charset=utf-8")
-			w.Status = response.InternalServerErrror
-			w.Body = []byte(content)
 			return &server.HandleError{
 				StatusCode: response.InternalServerErrror,
-				Message:    content,
+				Message:    "Okay, you know what? This one is on me.",
 			}
 
 		// handle proxy
 		case strings.HasPrefix(target, "/httpbin/"):
-			fmt.Println(target)
-
-			target := strings.TrimPrefix(target, "/httpbin/")
-
-			resp, err := http.Get(fmt.Sprintf("https://httpbin.org/%s", target))
-			if err != nil {
-				log.Println("error: http.Get() failed for proxying:", err)
-				return &server.HandleError{
-					StatusCode: response.InternalServerErrror,
-					Message:    err.Error(),
-				}
-			}
-			defer resp.Body.Close()
-
-			// Remove Content-Length and add Transfer-Encoding header
-			resp.Header.Del("Content-Length")
-			resp.Header.Add("Transfer-Encoding", "chunked")
-			// Announce X-Content-SHA256 and X-Content-Length as trailers in the Trailer header
-			resp.Header.Add("Trailer", "X-Content-SHA256")
-			resp.Header.Add("Trailer", "X-Content-Length")
-
-			// Buffer for storing all of body
-			bodyBuf := bytes.Buffer{}
-
-			// Read chunks from response
-			for {
-				buf := make([]byte, 1024)
-				n, err := resp.Body.Read(buf)
-				if err != nil {
-					if err == io.EOF {
-						log.Println("Successfully read and transferred all chunks to client")
-
-						// Calculate hash of the full response body and add the Trailers
-						bodyHash := sha256.Sum256(bodyBuf.Bytes())
-
-						trailers := headers.NewHeaders()
-						trailers["X-Content-SHA256"] = fmt.Sprintf("%x", bodyHash)
-						trailers["X-Content-Length"] = fmt.Sprintf("%d", bodyBuf.Len())
-
-						err := w.WriteTrailers(trailers)
-						if err != nil {
-							log.Println("error: w.WriteTrailers() failed:", err)
-						}
-
-						return nil
-					}
-
-					log.Println("error: resp.Body.Read() failed:", err)
-					return &server.HandleError{
-						StatusCode: response.InternalServerErrror,
-						Message:    err.Error(),
-					}
-				}
-				fmt.Printf("Read %d bytes from resp\n", n)
-
-				// Write response back to client
-				_, err = w.Conn.Write(buf[:n])
-				if err != nil {
-					log.Println("error: conn.Write() failed writing resp back to client:", err)
-					return nil
-				}
-
-				// Append to bodyBuf
-				_, err = bodyBuf.Write(buf)
-				if err != nil {
-					log.Println("error: bodyBuf.Write() failed appending to buffer:", err)
-					return &server.HandleError{
-						StatusCode: response.InternalServerErrror,
-						Message:    err.Error(),
-					}
-				}
-			}
+			return httpbin.Handle(w, req)
 
 		// handle video
 		case strings.HasPrefix(target, "/video"):
-			// Check if the request method is GET
-			if req.RequestLine.Method == "GET" {
-				data, err := os.ReadFile("assets/vim.mp4")
-				if err != nil {
-					log.Println("error: os.ReadFile() failed when reading the video into memory:", err)
-					return &server.HandleError{
-						StatusCode: response.InternalServerErrror,
-						Message:    err.Error(),
-					}
-				}
-
-				// Populate the response with necessary data
-				w.Headers = response.GetDefaultHeaders(len(data))
-				w.Headers.Replace("Content-Type", "video/mp4")
-				w.Status = response.OK
-				w.Body = data
-
-				// Write the Status line
-				err = w.WriteStatusLine()
-				if err != nil {
-					log.Println("error: WriteStatusLine() failed:", err)
-					return &server.HandleError{
-						StatusCode: response.InternalServerErrror,
-						Message:    err.Error(),
-					}
-				}
-
-				// Create and write the response headers
-				err = w.WriteHeaders()
-				if err != nil {
-					log.Println("error: response.WriteStatusLine() failed:", err)
-					return &server.HandleError{
-						StatusCode: response.InternalServerErrror,
-						Message:    err.Error(),
-					}
-				}
-
-				// Write the response body
-				_, err = w.WriteBody()
-				if err != nil {
-					log.Println("error: conn.Write() failed:", err)
-					return &server.HandleError{
-						StatusCode: response.InternalServerErrror,
-						Message:    err.Error(),
-					}
-				}
-			}
+			return fileserver.ServeFile(w, req, assets, "vim.mp4")
+
+		// handle static files
+		case strings.HasPrefix(target, "/assets/"):
+			return serveAssets(w, req)
+
 		default:
 			content := `<html>
   <head>
@@ -196,47 +105,74 @@ func main() {
     <p>Your request was an absolute banger.</p>
   </body>
 </html>`
-			w.Headers = response.GetDefaultHeaders(len(content))
-			w.Headers.Replace("Content-Type", "text/html; charset=utf-8")
-			w.Status = response.OK
-			w.Body = []byte(content)
+			w.Headers = headers.NewHeaders()
+			w.Headers.Set("Content-Type", "text/html; charset=utf-8")
+			w.Headers.Set("ETag", response.StrongETag([]byte(content)))
 
-			// Write the Status line
-			err := w.WriteStatusLine()
-			if err != nil {
-				log.Println("error: WriteStatusLine() failed:", err)
-				return &server.HandleError{
-					StatusCode: response.InternalServerErrror,
-					Message:    err.Error(),
-				}
+			// Answer revalidations with 304 Not Modified
+			if response.CheckPreconditions(w, req, time.Time{}) {
+				return nil
 			}
 
-			// Create and write the response headers
-			err = w.WriteHeaders()
+			// Status line, Content-Length and the rest are filled in by the writer
+			_, err := w.Write([]byte(content))
 			if err != nil {
-				log.Println("error: response.WriteStatusLine() failed:", err)
-				return &server.HandleError{
-					StatusCode: response.InternalServerErrror,
-					Message:    err.Error(),
-				}
-			}
-
-			// Write the response body
-			_, err = w.WriteBody()
-			if err != nil {
-				log.Println("error: conn.Write() failed:", err)
-				return &server.HandleError{
-					StatusCode: response.InternalServerErrror,
-					Message:    err.Error(),
-				}
+				log.Println("error: w.Write() failed:", err)
 			}
 			return nil
 		}
+	}
 
-		return nil
+	// Decode compressed uploads and compress responses for clients that accept it
+	handler := compress.DecodeRequests(compress.DecodeOptions{})(customHandlerFunc)
+	handler = compress.Middleware(compress.Options{})(handler)
+
+	// Access log in Combined Log Format on stdout, ACCESS_LOG_FILE writes it to a
+	// file rotated daily or at 100 MB instead, ACCESS_LOG_FORMAT picks common or json
+	format := accesslog.CombinedFormat
+	switch os.Getenv("ACCESS_LOG_FORMAT") {
+	case "common":
+		format = accesslog.CommonFormat
+	case "json":
+		format = accesslog.JSONFormat
+	}
+	var accessLogOut io.Writer = os.Stdout
+	if path := os.Getenv("ACCESS_LOG_FILE"); path != "" {
+		file := &accesslog.RotatingFile{
+			Path:       path,
+			MaxSize:    100 << 20,
+			MaxAge:     24 * time.Hour,
+			MaxBackups: 7,
+		}
+		defer file.Close()
+		accessLogOut = file
+	}
+	accessLog := accesslog.New(accessLogOut, format)
+
+	// Traces are sent to the OTLP/HTTP collector at OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+	// e.g. http://localhost:4318/v1/traces, and carried on to the proxied requests
+	var tracer *tracing.Tracer
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		serviceName := os.Getenv("OTEL_SERVICE_NAME")
+		if serviceName == "" {
+			serviceName = "go-http"
+		}
+		tracer = &tracing.Tracer{Exporter: otlp.New(endpoint, serviceName)}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracer.Close(ctx); err != nil {
+				log.Println("error: tracer.Close() failed:", err)
+			}
+		}()
 	}
 
-	server, err := server.Serve(port, customHandlerFunc)
+	server, err := server.ServeWithOptions(port, handler, server.Options{
+		Tracer:        tracer,
+		AccessLog:     accessLog.Log,
+		MetricsPath:   "/metrics",
+		MetricsRoutes: []string{"/", "/yourproblem", "/myproblem", "/httpbin/", "/video", "/assets/"},
+	})
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
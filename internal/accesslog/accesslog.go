@@ -0,0 +1,175 @@
+package accesslog
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+type Format int
+
+const (
+	// CommonFormat is the Common Log Format:
+	//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326
+	CommonFormat Format = iota
+	// CombinedFormat is the Common Log Format followed by the quoted Referer and User-Agent
+	CombinedFormat
+	// JSONFormat writes one JSON object per request through log/slog, with all fields of Record
+	JSONFormat
+)
+
+// clfTimeFormat is the timestamp layout of the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Record describes a single served request.
+type Record struct {
+	// Time is when the request's headers were received
+	Time       time.Time
+	Method     string
+	Target     string
+	Proto      string
+	Status     response.StatusCode
+	RemoteAddr string
+	// User is the Basic auth user name, if any
+	User      string
+	UserAgent string
+	Referer   string
+	RequestID string
+	// BytesIn is the size of the request body read, BytesOut of the response body sent
+	BytesIn  int64
+	BytesOut int64
+	Duration time.Duration
+}
+
+// Logger writes access log records in one format.
+type Logger struct {
+	format Format
+	mu     sync.Mutex
+	w      io.Writer
+	slog   *slog.Logger
+}
+
+// New creates a Logger writing to w, e.g. a RotatingFile. Each record is written with a single Write.
+func New(w io.Writer, format Format) *Logger {
+	l := &Logger{format: format, w: w}
+	if format == JSONFormat {
+		l.slog = slog.New(slog.NewJSONHandler(w, nil))
+	}
+	return l
+}
+
+// Log writes rec, it's safe for concurrent use.
+func (l *Logger) Log(rec Record) {
+	if l.format == JSONFormat {
+		// Timestamped with the request's arrival like the other formats
+		r := slog.NewRecord(rec.Time, slog.LevelInfo, "request", 0)
+		r.AddAttrs(
+			slog.String("method", rec.Method),
+			slog.String("target", rec.Target),
+			slog.String("proto", rec.Proto),
+			slog.Int("status", int(rec.Status)),
+			slog.String("remote_addr", rec.RemoteAddr),
+			slog.String("user", rec.User),
+			slog.String("user_agent", rec.UserAgent),
+			slog.String("referer", rec.Referer),
+			slog.String("request_id", rec.RequestID),
+			slog.Int64("bytes_in", rec.BytesIn),
+			slog.Int64("bytes_out", rec.BytesOut),
+			slog.Float64("duration_ms", float64(rec.Duration.Microseconds())/1000),
+		)
+		if err := l.slog.Handler().Handle(context.Background(), r); err != nil {
+			log.Println("error: writing access log failed:", err)
+		}
+		return
+	}
+
+	line := formatCommon(rec)
+	if l.format == CombinedFormat {
+		line += fmt.Sprintf(" %s %s", quote(rec.Referer), quote(rec.UserAgent))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := io.WriteString(l.w, line+"\n"); err != nil {
+		log.Println("error: writing access log failed:", err)
+	}
+}
+
+func formatCommon(rec Record) string {
+	host := rec.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	requestLine := "-"
+	if rec.Method != "" {
+		requestLine = rec.Method + " " + rec.Target + " " + rec.Proto
+	}
+
+	// CLF logs 0 bytes as "-"
+	bytesOut := "-"
+	if rec.BytesOut > 0 {
+		bytesOut = strconv.FormatInt(rec.BytesOut, 10)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] %s %d %s",
+		dash(host), dash(strings.ReplaceAll(escape(rec.User), " ", `\x20`)), rec.Time.Format(clfTimeFormat), quote(requestLine), rec.Status, bytesOut)
+}
+
+// BasicAuthUser returns the user name of a Basic Authorization header, or "".
+func BasicAuthUser(authorization string) string {
+	scheme, encoded, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(decoded), ":")
+	return user
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// quote wraps s in double quotes, escaping it so a field can't break the line apart.
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return `"` + escape(s) + `"`
+}
+
+// escape backslash escapes quotes and backslashes and replaces
+// non-printable bytes the way Apache does, e.g. "\x0a".
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
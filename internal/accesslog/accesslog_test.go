@@ -0,0 +1,119 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var record = Record{
+	Time:       time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+	Method:     "GET",
+	Target:     "/apache_pb.gif",
+	Proto:      "HTTP/1.1",
+	Status:     response.OK,
+	RemoteAddr: "127.0.0.1:52000",
+	User:       "frank",
+	UserAgent:  `Mozilla/4.08 [en] (Win98; I ;Nav) "quoted"`,
+	Referer:    "http://www.example.com/start.html",
+	RequestID:  "abc123",
+	BytesIn:    0,
+	BytesOut:   2326,
+	Duration:   1500 * time.Microsecond,
+}
+
+func TestFormats(t *testing.T) {
+	// Test: Common Log Format
+	buf := new(bytes.Buffer)
+	New(buf, CommonFormat).Log(record)
+	assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 200 2326`+"\n", buf.String())
+
+	// Test: Combined Log Format escapes quotes
+	buf.Reset()
+	New(buf, CombinedFormat).Log(record)
+	assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 200 2326 `+
+		`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav) \"quoted\""`+"\n", buf.String())
+
+	// Test: Missing fields and control characters
+	buf.Reset()
+	New(buf, CombinedFormat).Log(Record{Time: record.Time, Method: "GET", Target: "/a\nb", Proto: "HTTP/1.1", Status: response.NotFound})
+	assert.Equal(t, `- - - [10/Oct/2000:13:55:36 -0700] "GET /a\x0ab HTTP/1.1" 404 - "-" "-"`+"\n", buf.String())
+
+	// Test: JSON
+	buf.Reset()
+	New(buf, JSONFormat).Log(record)
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "2000-10-10T13:55:36-07:00", entry["time"])
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, "abc123", entry["request_id"])
+	assert.Equal(t, float64(2326), entry["bytes_out"])
+	assert.Equal(t, 1.5, entry["duration_ms"])
+}
+
+func TestBasicAuthUser(t *testing.T) {
+	assert.Equal(t, "Aladdin", BasicAuthUser("Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="))
+	assert.Equal(t, "", BasicAuthUser("Bearer token"))
+	assert.Equal(t, "", BasicAuthUser("Basic !!!"))
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "access.log")
+
+	// Test: Rotates by size and keeps MaxBackups
+	f := &RotatingFile{Path: path, MaxSize: 10, MaxBackups: 2}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(current))
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	second, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(second))
+
+	// Test: Appends to an existing file and rotates by age
+	f = &RotatingFile{Path: path, MaxAge: 50 * time.Millisecond}
+	_, err = f.Write([]byte("fifth\n"))
+	require.NoError(t, err)
+	current, _ = os.ReadFile(path)
+	assert.Equal(t, "fourth\nfifth\n", string(current))
+	time.Sleep(60 * time.Millisecond)
+	_, err = f.Write([]byte("sixth\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	current, _ = os.ReadFile(path)
+	assert.Equal(t, "sixth\n", string(current))
+	backups, _ = filepath.Glob(path + ".*")
+	assert.Len(t, backups, 3)
+	assert.True(t, strings.HasPrefix(filepath.Base(backups[0]), "access.log.2"))
+
+	// Test: An existing file's age is taken from its modification time
+	hourAgo := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, hourAgo, hourAgo))
+	f = &RotatingFile{Path: path, MaxAge: time.Minute}
+	_, err = f.Write([]byte("seventh\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	current, _ = os.ReadFile(path)
+	assert.Equal(t, "seventh\n", string(current))
+	backups, _ = filepath.Glob(path + ".*")
+	assert.Len(t, backups, 4)
+}
@@ -0,0 +1,142 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the path of rotated files, it sorts chronologically.
+const backupTimeFormat = "20060102-150405.000000000"
+
+// RotatingFile is an io.WriteCloser appending to the file at Path. The file is
+// renamed to Path plus a timestamp suffix and a new one started once it would
+// grow past MaxSize or gets older than MaxAge.
+type RotatingFile struct {
+	Path string
+	// MaxSize in bytes before rotating, 0 means no limit
+	MaxSize int64
+	// MaxAge of the current file before rotating, 0 means no limit
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept, 0 keeps all of them
+	MaxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// Write appends p to the file, rotating first if needed. A single write is
+// never split across files, so it may exceed MaxSize on its own.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	tooBig := f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize
+	tooOld := f.MaxAge > 0 && time.Since(f.opened) >= f.MaxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file, a later Write opens it again.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens Path for appending, creating its directory if needed. The age
+// of a file appended to is taken from its modification time.
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	// An existing file's age counts from before the restart
+	if f.size > 0 {
+		f.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.Path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(f.Path, backup); err != nil {
+		return fmt.Errorf("error: rotating %s failed: %w", f.Path, err)
+	}
+	if err := f.removeOldBackups(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// removeOldBackups deletes the oldest rotated files beyond MaxBackups.
+func (f *RotatingFile) removeOldBackups() error {
+	if f.MaxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, f.Path+".")
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	if len(backups) <= f.MaxBackups {
+		return nil
+	}
+
+	slices.Sort(backups)
+	for _, backup := range backups[:len(backups)-f.MaxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package chunked
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/headers"
+)
+
+const (
+	parsingSize = iota
+	parsingData
+	parsingTrailers
+	done
+)
+
+// MaxChunkSize caps a single chunk of a chunked body.
+const MaxChunkSize = 1 << 30
+
+// ErrChunkTooLarge is returned for a chunk bigger than MaxChunkSize.
+var ErrChunkTooLarge = errors.New("error: chunk too large")
+
+// Decoder decodes a chunked body (RFC 9112 Section 7.1) as it arrives.
+// The zero value is ready to use.
+type Decoder struct {
+	// Trailers sent after the last chunk, set once Done reports true.
+	// Fields forbidden in trailers are dropped
+	Trailers headers.Headers
+
+	state int
+	// Bytes left in the chunk being decoded
+	remaining int64
+}
+
+// Done reports whether the last chunk and the trailers have been decoded.
+func (d *Decoder) Done() bool {
+	return d.state == done
+}
+
+// Remaining returns the bytes left in the chunk being decoded.
+func (d *Decoder) Remaining() int64 {
+	return d.remaining
+}
+
+// Decode decodes one step of data: a chunk size line, chunk data, the CRLF
+// after it or a trailer line. It returns the bytes consumed and the body
+// bytes among them, n is 0 when more data is needed.
+func (d *Decoder) Decode(data []byte) (n int, chunk []byte, err error) {
+	switch d.state {
+	case parsingSize:
+		index := bytes.Index(data, []byte("\r\n"))
+		if index == -1 {
+			return 0, nil, nil // need more data
+		}
+
+		// Ignore chunk extensions
+		sizeStr, _, _ := strings.Cut(string(data[:index]), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+		if err != nil || size < 0 {
+			return 0, nil, fmt.Errorf("error: invalid chunk size: %q", sizeStr)
+		}
+		if size > MaxChunkSize {
+			return 0, nil, fmt.Errorf("%w: %d bytes", ErrChunkTooLarge, size)
+		}
+
+		if size == 0 {
+			d.Trailers = headers.NewHeaders()
+			d.state = parsingTrailers
+		} else {
+			d.remaining = size
+			d.state = parsingData
+		}
+		return index + 2, nil, nil
+
+	case parsingData:
+		if d.remaining > 0 {
+			n := min(int64(len(data)), d.remaining)
+			d.remaining -= n
+			return int(n), data[:n], nil
+		}
+
+		// Chunk data is followed by CRLF
+		if len(data) < 2 {
+			return 0, nil, nil // need more data
+		}
+		if !bytes.Equal(data[:2], []byte("\r\n")) {
+			return 0, nil, fmt.Errorf("error: missing CRLF after chunk data")
+		}
+		d.state = parsingSize
+		return 2, nil, nil
+
+	case parsingTrailers:
+		n, finished, err := d.Trailers.Parse(data)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if finished {
+			for key := range d.Trailers {
+				if headers.IsForbiddenTrailer(key) {
+					delete(d.Trailers, key)
+				}
+			}
+			d.state = done
+		}
+		return n, nil, nil
+
+	default:
+		return 0, nil, nil
+	}
+}
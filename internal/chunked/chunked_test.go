@@ -0,0 +1,65 @@
+package chunked
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decode feeds data to d a byte at a time and returns the decoded body.
+func decode(t *testing.T, d *Decoder, data string) ([]byte, error) {
+	t.Helper()
+	var body, buf []byte
+	for i := 0; i < len(data) && !d.Done(); i++ {
+		buf = append(buf, data[i])
+		for {
+			n, chunk, err := d.Decode(buf)
+			if err != nil {
+				return body, err
+			}
+			body = append(body, chunk...)
+			buf = buf[n:]
+			if n == 0 || d.Done() {
+				break
+			}
+		}
+	}
+	return body, nil
+}
+
+func TestDecoder(t *testing.T) {
+	// Test: Chunks with extensions and trailers, forbidden trailers are dropped
+	d := &Decoder{}
+	body, err := decode(t, d, "5;name=value\r\nhello\r\n6\r\n world\r\n0\r\nX-Sum: 1\r\nContent-Length: 11\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, d.Done())
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, "1", d.Trailers.Get("X-Sum"))
+	assert.Empty(t, d.Trailers.Get("Content-Length"))
+
+	// Test: Chunk data is consumed as far as it's available
+	d = &Decoder{}
+	n, chunk, err := d.Decode([]byte("a\r\nabc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Nil(t, chunk)
+	assert.Equal(t, int64(10), d.Remaining())
+	n, chunk, err = d.Decode([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "abc", string(chunk))
+	assert.Equal(t, int64(7), d.Remaining())
+
+	// Test: Invalid chunk size
+	_, err = decode(t, &Decoder{}, "xyz\r\n")
+	assert.Error(t, err)
+
+	// Test: Chunk too large
+	_, err = decode(t, &Decoder{}, "7fffffff\r\n")
+	assert.ErrorIs(t, err, ErrChunkTooLarge)
+
+	// Test: Missing CRLF after chunk data
+	_, err = decode(t, &Decoder{}, "3\r\nabcd\r\n")
+	assert.Error(t, err)
+}
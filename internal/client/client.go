@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+const (
+	defaultMaxRedirects = 10
+	// maxDrainSize is how much of a redirect's body is read to let the connection finish cleanly
+	maxDrainSize = 4 << 10
+)
+
+// ErrUseLastResponse can be returned by Client.CheckRedirect to stop
+// following redirects and return the redirect response itself.
+var ErrUseLastResponse = errors.New("error: use last response")
+
+// Client sends requests through a RoundTripper and follows redirects.
+type Client struct {
+	// Transport sends the requests, defaults to DefaultTransport
+	Transport RoundTripper
+	// Timeout limits the whole exchange including redirects and reading the body, 0 means no limit
+	Timeout time.Duration
+	// CheckRedirect is called before following a redirect to req, via holds the requests
+	// made so far, oldest first. If it returns an error the redirect isn't followed,
+	// the default policy stops after 10 redirects
+	CheckRedirect func(req *Request, via []*Request) error
+}
+
+// DefaultClient is a Client with no timeout and the default redirect policy.
+var DefaultClient = &Client{}
+
+// Get sends a GET request to url.
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	req, err := NewRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Post sends a POST request to url with the body of the given content type.
+func (c *Client) Post(ctx context.Context, url string, contentType string, body []byte) (*Response, error) {
+	req, err := NewRequest(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Headers.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+// Do sends req and follows redirects according to CheckRedirect.
+// If the error is nil the caller must close the response body.
+func (c *Client) Do(req *Request) (*Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+
+	cancel := func() {}
+	if c.Timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), c.Timeout)
+		req = req.WithContext(ctx)
+	}
+
+	var via []*Request
+	for {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		next, err := c.redirect(req, resp, via)
+		if next == nil {
+			if err != nil {
+				resp.Body.Close()
+				cancel()
+				return nil, err
+			}
+			if resp.StatusCode == response.SwitchingProtocols {
+				// The upgraded connection outlives the exchange
+				cancel()
+				return resp, nil
+			}
+			// The timeout covers reading the body, it ends once the body is closed
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		// Let the connection finish the redirect's body before it's dropped
+		io.CopyN(io.Discard, resp.Body, maxDrainSize)
+		resp.Body.Close()
+
+		via = append(via, req)
+		req = next
+	}
+}
+
+// redirect returns the request to follow resp with, or nil to stop at resp.
+func (c *Client) redirect(req *Request, resp *Response, via []*Request) (*Request, error) {
+	switch resp.StatusCode {
+	case response.MovedPermanently, response.Found, response.SeeOther,
+		response.TemporaryRedirect, response.PermanentRedirect:
+	default:
+		return nil, nil
+	}
+
+	location := resp.Headers.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	u, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid redirect Location %q: %w", location, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("error: unsupported redirect scheme: %q", u.Scheme)
+	}
+
+	next := req.clone()
+	next.URL = u
+	next.Headers.Del("Host")
+
+	// 301 and 302 historically turn POST into GET, 303 always means GET (RFC 9110 Section 15.4)
+	switch {
+	case resp.StatusCode == response.SeeOther && req.Method != "HEAD",
+		(resp.StatusCode == response.MovedPermanently || resp.StatusCode == response.Found) && req.Method == "POST":
+		next.Method = "GET"
+		next.Body = nil
+		next.Headers.Del("Content-Type")
+	}
+
+	// Don't leak credentials to another host
+	if !strings.EqualFold(u.Host, req.URL.Host) {
+		next.Headers.Del("Authorization")
+		next.Headers.Del("Cookie")
+		next.Headers.Del("Proxy-Authorization")
+	}
+
+	via = append(via, req)
+	checkRedirect := c.CheckRedirect
+	if checkRedirect == nil {
+		checkRedirect = defaultCheckRedirect
+	}
+	err = checkRedirect(next, via)
+	if errors.Is(err, ErrUseLastResponse) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func defaultCheckRedirect(req *Request, via []*Request) error {
+	if len(via) >= defaultMaxRedirects {
+		return fmt.Errorf("error: stopped after %d redirects", defaultMaxRedirects)
+	}
+	return nil
+}
+
+// cancelBody releases the client's timeout once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (c *cancelBody) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawServer answers every connection with the given bytes after reading the request headers.
+func rawServer(t *testing.T, raw string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				conn.Read(buf)
+				conn.Write([]byte(raw))
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String()
+}
+
+func TestClientBodies(t *testing.T) {
+	ctx := context.Background()
+
+	// Test: Content-Length body
+	resp, err := DefaultClient.Get(ctx, rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nX-Test: 1\r\n\r\nhello"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, response.OK, resp.StatusCode)
+	assert.Equal(t, "OK", resp.Reason)
+	assert.Equal(t, int64(5), resp.ContentLength)
+	assert.Equal(t, "1", resp.Headers.Get("X-Test"))
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Interim responses are skipped, chunked body with trailers
+	resp, err = DefaultClient.Get(ctx, rawServer(t, "HTTP/1.1 103 Early Hints\r\nLink: </a.css>; rel=preload\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\nSet-Cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\nSet-Cookie: b=2\r\n\r\n"+
+		"5;ext=1\r\nhello\r\n6\r\n world\r\n0\r\nX-Sum: abc\r\nContent-Length: 1\r\n\r\n"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.Equal(t, "abc", resp.Trailers.Get("X-Sum"))
+	assert.Empty(t, resp.Trailers.Get("Content-Length"))
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "b=2"}, resp.SetCookies)
+
+	// Test: Chunked body with Content-Length closes the connection
+	resp, err = DefaultClient.Get(ctx, rawServer(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.True(t, resp.Close)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Body delimited by connection close
+	resp, err = DefaultClient.Get(ctx, rawServer(t, "HTTP/1.1 200 OK\r\n\r\nuntil the end"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.True(t, resp.Close)
+	assert.Equal(t, "until the end", string(body))
+
+	// Test: Truncated Content-Length body
+	resp, err = DefaultClient.Get(ctx, rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	resp.Body.Close()
+
+	// Test: Chunked body cut off between chunks
+	resp, err = DefaultClient.Get(ctx, rawServer(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "hello", string(body))
+	resp.Body.Close()
+
+	// Test: HEAD and 304 have no body
+	req, err := NewRequest(ctx, "HEAD", rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\n"), nil)
+	require.NoError(t, err)
+	resp, err = DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Empty(t, body)
+	assert.Equal(t, int64(42), resp.ContentLength)
+
+	// Test: Malformed status line
+	_, err = DefaultClient.Get(ctx, rawServer(t, "HTTP/2 200 OK\r\n\r\n"))
+	assert.Error(t, err)
+}
+
+func TestClientRequests(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/see-other":
+			http.Redirect(w, r, "/done", http.StatusSeeOther)
+		case "/temporary":
+			http.Redirect(w, r, "/done", http.StatusTemporaryRedirect)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Write([]byte("done"))
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Test: Method, headers and body are sent
+	req, err := NewRequest(ctx, "PUT", srv.URL+"/items?id=1", []byte("payload"))
+	require.NoError(t, err)
+	req.Headers.Set("X-Custom", "yes")
+	resp, err := DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "PUT", got.Method)
+	assert.Equal(t, "/items", got.URL.Path)
+	assert.Equal(t, "id=1", got.URL.RawQuery)
+	assert.Equal(t, "yes", got.Header.Get("X-Custom"))
+	assert.Equal(t, "payload", string(gotBody))
+
+	// Test: 303 turns POST into GET, 307 keeps method and body
+	resp, err = DefaultClient.Post(ctx, srv.URL+"/see-other", "text/plain", []byte("form"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "GET", got.Method)
+	assert.Equal(t, "/done", resp.Request.URL.Path)
+	resp, err = DefaultClient.Post(ctx, srv.URL+"/temporary", "text/plain", []byte("form"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "form", string(gotBody))
+
+	// Test: Redirect policies
+	_, err = DefaultClient.Get(ctx, srv.URL+"/loop")
+	assert.ErrorContains(t, err, "stopped after 10 redirects")
+	noFollow := &Client{CheckRedirect: func(req *Request, via []*Request) error { return ErrUseLastResponse }}
+	resp, err = noFollow.Get(ctx, srv.URL+"/see-other")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, response.SeeOther, resp.StatusCode)
+
+	// Test: Header injection is refused
+	req, err = NewRequest(ctx, "GET", srv.URL, nil)
+	require.NoError(t, err)
+	req.Headers.Set("X-Bad", "a\r\nX-Injected: 1")
+	_, err = DefaultClient.Do(req)
+	assert.Error(t, err)
+}
+
+func TestClientTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// Test: Client timeout
+	c := &Client{Timeout: 50 * time.Millisecond}
+	_, err := c.Get(context.Background(), srv.URL)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+
+	// Test: Context cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = DefaultClient.Get(ctx, srv.URL)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+
+	// Test: Response header timeout
+	c = &Client{Transport: &Transport{ResponseHeaderTimeout: 50 * time.Millisecond}}
+	_, err = c.Get(context.Background(), srv.URL)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
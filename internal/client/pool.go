@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 2
+	defaultIdleTimeout         = 90 * time.Second
+)
+
+// idempotentMethods may be sent again after a failure (RFC 9110 Section 9.2.2).
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// PooledTransport keeps connections open after a response and reuses them for later requests to the same host.
+type PooledTransport struct {
+	Transport
+
+	// MaxIdleConns caps the idle connections across all hosts, defaults to 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections kept per host, defaults to 2
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the open connections per host, idle or not. Requests
+	// wait for a connection to free up once it's reached, 0 means no limit
+	MaxConnsPerHost int
+	// IdleTimeout is how long a connection stays idle before it's closed, defaults to 90s
+	IdleTimeout time.Duration
+
+	mu      sync.Mutex
+	idle    map[string][]*persistConn
+	open    map[string]int
+	waiters map[string][]chan struct{}
+	stats   PoolStats
+}
+
+// PoolStats are counters of a PooledTransport.
+type PoolStats struct {
+	// Open and Idle are the connections currently open and idle in the pool
+	Open int
+	Idle int
+	// Dials counts new connections, Reuses requests sent on a pooled one
+	Dials  int64
+	Reuses int64
+	// Stale counts pooled connections found closed by the server before reuse,
+	// Retries the requests sent again after a reused connection failed
+	Stale   int64
+	Retries int64
+	// IdleClosed counts connections closed for exceeding IdleTimeout or the idle limits
+	IdleClosed int64
+	// Waits counts requests that waited for MaxConnsPerHost
+	Waits int64
+}
+
+// Stats returns a snapshot of the pool's counters.
+func (t *PooledTransport) Stats() PoolStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.stats
+	for _, conns := range t.idle {
+		stats.Idle += len(conns)
+	}
+	for _, n := range t.open {
+		stats.Open += n
+	}
+	return stats
+}
+
+func (t *PooledTransport) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context()
+
+	pc, err := t.getConn(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := roundTrip(ctx, pc, req, t.ResponseHeaderTimeout, t.putConn)
+	if err == nil {
+		return t.detachUpgrade(pc, resp), nil
+	}
+	t.closeConn(pc)
+
+	// A pooled connection may have been closed by the server while we sent on it,
+	// idempotent requests get one more try on a fresh connection
+	var noResp *noResponseError
+	if !pc.reused || !errors.As(err, &noResp) || !idempotentMethods[req.Method] || ctx.Err() != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.stats.Retries++
+	t.mu.Unlock()
+
+	pc, err = t.getConn(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = roundTrip(ctx, pc, req, t.ResponseHeaderTimeout, t.putConn)
+	if err != nil {
+		t.closeConn(pc)
+		return nil, err
+	}
+	return t.detachUpgrade(pc, resp), nil
+}
+
+// CloseIdleConnections closes all idle connections.
+func (t *PooledTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	var conns []*persistConn
+	for key, idle := range t.idle {
+		conns = append(conns, idle...)
+		delete(t.idle, key)
+	}
+	t.mu.Unlock()
+
+	for _, pc := range conns {
+		pc.idleTimer.Stop()
+		t.closeConn(pc)
+	}
+}
+
+// getConn returns an idle connection for req's host if there's a live one
+// and reuse is set, otherwise it dials a new one once the host has room.
+func (t *PooledTransport) getConn(ctx context.Context, req *Request, reuse bool) (*persistConn, error) {
+	key := req.URL.Scheme + "://" + hostPort(req)
+	waited := false
+
+	for {
+		t.mu.Lock()
+		if t.open == nil {
+			t.idle = make(map[string][]*persistConn)
+			t.open = make(map[string]int)
+			t.waiters = make(map[string][]chan struct{})
+		}
+
+		if reuse && len(t.idle[key]) > 0 {
+			// Most recently used first, it's the least likely to have timed out
+			conns := t.idle[key]
+			pc := conns[len(conns)-1]
+			t.idle[key] = conns[:len(conns)-1]
+			pc.idleTimer.Stop()
+			t.mu.Unlock()
+
+			if pc.alive() {
+				t.mu.Lock()
+				pc.reused = true
+				t.stats.Reuses++
+				t.mu.Unlock()
+				return pc, nil
+			}
+
+			t.mu.Lock()
+			t.stats.Stale++
+			t.mu.Unlock()
+			t.closeConn(pc)
+			continue
+		}
+
+		if t.MaxConnsPerHost <= 0 || t.open[key] < t.MaxConnsPerHost {
+			t.open[key]++
+			t.mu.Unlock()
+			break
+		}
+
+		// Wait for a connection of this host to be closed or returned
+		ready := make(chan struct{})
+		t.waiters[key] = append(t.waiters[key], ready)
+		if !waited {
+			t.stats.Waits++
+			waited = true
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-ready:
+			reuse = true
+		case <-ctx.Done():
+			t.removeWaiter(key, ready)
+			return nil, ctx.Err()
+		}
+	}
+
+	conn, err := t.dial(ctx, req)
+	if err != nil {
+		t.mu.Lock()
+		t.open[key]--
+		t.notifyLocked(key)
+		t.mu.Unlock()
+		return nil, contextError(ctx, err)
+	}
+	t.mu.Lock()
+	t.stats.Dials++
+	t.mu.Unlock()
+	return newPersistConn(conn, key), nil
+}
+
+// putConn is called once a response body is done with, it keeps reusable connections idle.
+func (t *PooledTransport) putConn(pc *persistConn, reusable bool) error {
+	if !reusable {
+		return t.closeConn(pc)
+	}
+
+	maxIdle := t.MaxIdleConns
+	if maxIdle == 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+	maxPerHost := t.MaxIdleConnsPerHost
+	if maxPerHost == 0 {
+		maxPerHost = defaultMaxIdleConnsPerHost
+	}
+	idleTimeout := t.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+
+	t.mu.Lock()
+	total := 0
+	for _, conns := range t.idle {
+		total += len(conns)
+	}
+	if len(t.idle[pc.key]) >= maxPerHost || total >= maxIdle {
+		t.stats.IdleClosed++
+		t.mu.Unlock()
+		return t.closeConn(pc)
+	}
+
+	pc.idleTimer = time.AfterFunc(idleTimeout, func() {
+		t.expire(pc)
+	})
+	t.idle[pc.key] = append(t.idle[pc.key], pc)
+	t.notifyLocked(pc.key)
+	t.mu.Unlock()
+	return nil
+}
+
+// expire closes pc if it's still idle.
+func (t *PooledTransport) expire(pc *persistConn) {
+	t.mu.Lock()
+	conns := t.idle[pc.key]
+	for i, idle := range conns {
+		if idle == pc {
+			t.idle[pc.key] = append(conns[:i], conns[i+1:]...)
+			t.stats.IdleClosed++
+			t.mu.Unlock()
+			t.closeConn(pc)
+			return
+		}
+	}
+	t.mu.Unlock()
+}
+
+// closeConn closes pc and frees its slot for the host.
+func (t *PooledTransport) closeConn(pc *persistConn) error {
+	t.mu.Lock()
+	t.open[pc.key]--
+	if t.open[pc.key] <= 0 {
+		delete(t.open, pc.key)
+	}
+	t.notifyLocked(pc.key)
+	t.mu.Unlock()
+	return pc.conn.Close()
+}
+
+// detachUpgrade takes a connection that switched protocols out of the pool's accounting.
+func (t *PooledTransport) detachUpgrade(pc *persistConn, resp *Response) *Response {
+	if resp.StatusCode == response.SwitchingProtocols {
+		t.mu.Lock()
+		t.open[pc.key]--
+		t.notifyLocked(pc.key)
+		t.mu.Unlock()
+	}
+	return resp
+}
+
+// notifyLocked wakes the first request waiting for a connection to key.
+func (t *PooledTransport) notifyLocked(key string) {
+	if waiters := t.waiters[key]; len(waiters) > 0 {
+		close(waiters[0])
+		t.waiters[key] = waiters[1:]
+	}
+}
+
+func (t *PooledTransport) removeWaiter(key string, ready chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	waiters := t.waiters[key]
+	for i, w := range waiters {
+		if w == ready {
+			t.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			return
+		}
+	}
+	// Already notified, pass the wakeup on
+	t.notifyLocked(key)
+}
+
+// alive reports whether an idle connection is still usable. A closed connection
+// reads EOF right away, anything else read before a request was sent is bogus too.
+func (pc *persistConn) alive() bool {
+	if pc.br.Buffered() > 0 {
+		return false
+	}
+
+	pc.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := pc.br.Peek(1)
+	pc.conn.SetReadDeadline(time.Time{})
+
+	// Timing out means nothing was there to read
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, c *Client, url string) string {
+	resp, err := c.Get(context.Background(), url)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(body)
+}
+
+func TestPooledTransportReuse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := strings.CutPrefix(r.URL.Path, "/status/"); ok {
+			code, _ := strconv.Atoi(status)
+			w.Header().Set("Content-Length", "7")
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte("pooled"))
+	}))
+	defer srv.Close()
+
+	transport := &PooledTransport{IdleTimeout: 100 * time.Millisecond}
+	c := &Client{Transport: transport}
+
+	// Test: Sequential requests share one connection
+	for range 3 {
+		assert.Equal(t, "pooled", get(t, c, srv.URL))
+	}
+	stats := transport.Stats()
+	assert.Equal(t, int64(1), stats.Dials)
+	assert.Equal(t, int64(2), stats.Reuses)
+	assert.Equal(t, 1, stats.Idle)
+	assert.Equal(t, 1, stats.Open)
+
+	// Test: Connections closed by the server are detected before reuse
+	srv.CloseClientConnections()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, "pooled", get(t, c, srv.URL))
+	stats = transport.Stats()
+	assert.Equal(t, int64(1), stats.Stale)
+	assert.Equal(t, int64(2), stats.Dials)
+
+	// Test: Bodyless responses are reused without reading the body
+	for _, status := range []int{http.StatusNoContent, http.StatusNotModified} {
+		resp, err := c.Get(context.Background(), srv.URL+fmt.Sprintf("/status/%d", status))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	stats = transport.Stats()
+	assert.Equal(t, int64(2), stats.Dials)
+	assert.Equal(t, 1, stats.Idle)
+
+	// Test: Failed dials aren't counted
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln.Close()
+	_, err = c.Get(context.Background(), "http://"+ln.Addr().String())
+	require.Error(t, err)
+	assert.Equal(t, int64(2), transport.Stats().Dials)
+
+	// Test: Idle connections are closed after IdleTimeout
+	assert.Eventually(t, func() bool { return transport.Stats().Open == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), transport.Stats().IdleClosed)
+}
+
+func TestPooledTransportRetry(t *testing.T) {
+	// Answers the first request on each connection, then drops the connection on the second
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for i := 0; ; i++ {
+					for {
+						line, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line == "\r\n" {
+							break
+						}
+					}
+					if i > 0 {
+						return
+					}
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				}
+			}()
+		}
+	}()
+	url := "http://" + ln.Addr().String()
+
+	transport := &PooledTransport{}
+	c := &Client{Transport: transport}
+
+	// Test: Idempotent request is retried once on a fresh connection
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, int64(1), transport.Stats().Retries)
+
+	// Test: Non-idempotent requests aren't
+	_, err = c.Post(context.Background(), url, "text/plain", []byte("x"))
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), transport.Stats().Retries)
+}
+
+func TestPooledTransportMaxConnsPerHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("limited"))
+	}))
+	defer srv.Close()
+
+	transport := &PooledTransport{MaxConnsPerHost: 1}
+	c := &Client{Transport: transport}
+
+	first, err := c.Get(context.Background(), srv.URL)
+	require.NoError(t, err)
+
+	// Test: Second request waits for the first connection to be released
+	done := make(chan string)
+	go func() {
+		done <- get(t, c, srv.URL)
+	}()
+	select {
+	case <-done:
+		t.Fatal("request didn't wait for a free connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	io.ReadAll(first.Body)
+	first.Body.Close()
+	assert.Equal(t, "limited", <-done)
+
+	stats := transport.Stats()
+	assert.Equal(t, int64(1), stats.Dials)
+	assert.Equal(t, int64(1), stats.Waits)
+
+	// Test: Waiting respects the context
+	held, err := c.Get(context.Background(), srv.URL)
+	require.NoError(t, err)
+	defer held.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.Get(ctx, srv.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
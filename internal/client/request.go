@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/headers"
+)
+
+const userAgent = "go-http"
+
+// Request is an outgoing HTTP/1.1 request.
+type Request struct {
+	Method  string
+	URL     *url.URL
+	Headers headers.Headers
+	// Body is sent with a Content-Length, it's kept in memory so the request can be replayed on redirects and retries
+	Body []byte
+
+	ctx context.Context
+}
+
+// NewRequest creates a Request for method and rawURL, which must be an absolute http or https URL.
+func NewRequest(ctx context.Context, method string, rawURL string, body []byte) (*Request, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("error: nil context")
+	}
+	if method == "" {
+		method = "GET"
+	}
+	for _, char := range method {
+		if char < 'A' || char > 'Z' {
+			return nil, fmt.Errorf("error: invalid method: %q", method)
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("error: unsupported scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("error: missing host in URL: %q", rawURL)
+	}
+
+	return &Request{
+		Method:  method,
+		URL:     u,
+		Headers: headers.NewHeaders(),
+		Body:    body,
+		ctx:     ctx,
+	}, nil
+}
+
+// Context returns the request's context, it bounds the whole exchange including reading the body.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r using ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// clone returns a copy of r that can be modified without affecting r.
+func (r *Request) clone() *Request {
+	r2 := *r
+	u := *r.URL
+	r2.URL = &u
+	r2.Headers = headers.NewHeaders()
+	for key, value := range r.Headers {
+		r2.Headers[key] = value
+	}
+	return &r2
+}
+
+// write serializes the request line, headers and body.
+func (r *Request) write(w *bufio.Writer) error {
+	target := r.URL.RequestURI()
+	if target == "" {
+		target = "/"
+	}
+	if _, err := fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", r.Method, target); err != nil {
+		return err
+	}
+
+	host := r.Headers.Get("Host")
+	if host == "" {
+		host = r.URL.Host
+	}
+	if err := writeHeader(w, "Host", host); err != nil {
+		return err
+	}
+	if !r.Headers.Has("User-Agent") {
+		if err := writeHeader(w, "User-Agent", userAgent); err != nil {
+			return err
+		}
+	}
+	// Servers may reject bodyless POSTs without a length (411 Length Required)
+	if len(r.Body) > 0 || r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" {
+		if err := writeHeader(w, "Content-Length", strconv.Itoa(len(r.Body))); err != nil {
+			return err
+		}
+	}
+
+	// Sorted so requests are reproducible on the wire
+	keys := make([]string, 0, len(r.Headers))
+	for key := range r.Headers {
+		switch strings.ToLower(key) {
+		case "host", "content-length", "transfer-encoding":
+			// Framing and routing are derived from the request itself
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writeHeader(w, key, r.Headers[key]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	if _, err := w.Write(r.Body); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeHeader(w *bufio.Writer, key string, value string) error {
+	// Refuse to let values smuggle in extra headers or a second request
+	if strings.ContainsAny(key, "\r\n: ") || strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("error: invalid header field: %q", key)
+	}
+	_, err := fmt.Fprintf(w, "%s: %s\r\n", key, value)
+	return err
+}
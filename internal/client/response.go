@@ -0,0 +1,256 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/chunked"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/parser"
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+const (
+	// maxInterimResponses caps the 1xx responses skipped before the final one
+	maxInterimResponses = 10
+	// maxLineLength caps status, header and chunk size lines
+	maxLineLength = 64 << 10
+)
+
+// Response is a response received from a server.
+type Response struct {
+	// Proto is the version from the status line, "HTTP/1.1" or "HTTP/1.0"
+	Proto      string
+	StatusCode response.StatusCode
+	// Reason is the reason phrase of the status line, e.g. "Not Found"
+	Reason  string
+	Headers headers.Headers
+	// SetCookies holds the raw Set-Cookie values, they're kept apart because
+	// they can't be combined into one field (RFC 6265 Section 3)
+	SetCookies []string
+
+	// Body streams the response body and must be closed. For 101 Switching
+	// Protocols it's the connection itself and also implements io.Writer
+	Body io.ReadCloser
+	// ContentLength is the body length, -1 if it isn't known up front
+	ContentLength int64
+	// Trailers are filled in once a chunked Body has been read to the end
+	Trailers headers.Headers
+	// Close is set when the server closes the connection after this response
+	Close bool
+
+	// Request is the request that was sent to get this response,
+	// after following redirects it's the last one
+	Request *Request
+}
+
+// readResponse reads the status line and headers of the final response to
+// req from br, skipping 1xx interim responses, and sets up the body reader.
+func readResponse(br *bufio.Reader, req *Request) (*Response, error) {
+	resp := &Response{Request: req}
+
+	for i := 0; ; i++ {
+		if i > maxInterimResponses {
+			return nil, fmt.Errorf("error: too many 1xx responses")
+		}
+
+		line, err := readLine(br)
+		if err != nil {
+			return nil, err
+		}
+		statusLine, err := parser.ParseStatusLine(line)
+		if err != nil {
+			return nil, err
+		}
+		resp.Proto = "HTTP/" + statusLine.HttpVersion
+		resp.StatusCode = statusLine.StatusCode
+		resp.Reason = statusLine.ReasonPhrase
+
+		resp.Headers, resp.SetCookies, err = readHeaders(br)
+		if err != nil {
+			return nil, err
+		}
+
+		// Interim responses are followed by the final one, except for a protocol switch
+		if resp.StatusCode < 200 && resp.StatusCode != response.SwitchingProtocols {
+			continue
+		}
+		break
+	}
+
+	resp.Close = hasToken(resp.Headers.Get("Connection"), "close")
+	if resp.Proto == "HTTP/1.0" && !hasToken(resp.Headers.Get("Connection"), "keep-alive") {
+		resp.Close = true
+	}
+	resp.ContentLength = -1
+
+	switch {
+	case resp.StatusCode == response.SwitchingProtocols:
+		// Set up by the transport, which owns the connection
+	case noBody(req.Method, resp.StatusCode):
+		resp.ContentLength = 0
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		if req.Method == "HEAD" {
+			// A HEAD response reports the length a GET would have had
+			if n, err := strconv.ParseInt(resp.Headers.Get("Content-Length"), 10, 64); err == nil {
+				resp.ContentLength = n
+			}
+		}
+	case resp.Headers.Get("Transfer-Encoding") != "":
+		codings := strings.Split(resp.Headers.Get("Transfer-Encoding"), ",")
+		if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			// Only chunked is self-delimiting, anything else runs until close (RFC 9112 Section 6.3)
+			resp.Close = true
+			resp.Body = io.NopCloser(br)
+			break
+		}
+		// Both framings may be an attempt at smuggling, the connection
+		// mustn't be reused (RFC 9112 Section 6.1)
+		if resp.Headers.Get("Content-Length") != "" {
+			resp.Close = true
+		}
+		resp.Body = io.NopCloser(&chunkedReader{br: br, resp: resp})
+	case resp.Headers.Get("Content-Length") != "":
+		n, err := strconv.ParseInt(resp.Headers.Get("Content-Length"), 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("error: invalid Content-Length: %q", resp.Headers.Get("Content-Length"))
+		}
+		resp.ContentLength = n
+		resp.Body = io.NopCloser(&lengthReader{r: br, remaining: n})
+	default:
+		// Delimited by the server closing the connection
+		resp.Close = true
+		resp.Body = io.NopCloser(br)
+	}
+
+	return resp, nil
+}
+
+// readHeaders reads header lines up to the empty line using headers.Parse.
+func readHeaders(br *bufio.Reader) (headers.Headers, []string, error) {
+	h := headers.NewHeaders()
+	var setCookies []string
+
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		if line == "" {
+			return h, setCookies, nil
+		}
+
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "Set-Cookie") {
+			setCookies = append(setCookies, strings.TrimSpace(value))
+			continue
+		}
+
+		_, _, err = h.Parse([]byte(line + "\r\n"))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// readLine reads a CRLF terminated line without the CRLF.
+func readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, err := br.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > maxLineLength {
+			return "", fmt.Errorf("error: line too long")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("error: line not terminated by CRLF")
+	}
+	return string(line[:len(line)-2]), nil
+}
+
+// noBody reports whether a response to method with status never has a body (RFC 9112 Section 6.3).
+func noBody(method string, status response.StatusCode) bool {
+	return method == "HEAD" || status < 200 || status == response.NoContent || status == response.NotModified
+}
+
+func hasToken(value string, token string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// lengthReader reads a body of a known length and reports a truncated one.
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err == io.EOF && l.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if l.remaining == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunkedReader decodes a chunked body and stores its trailers on resp.
+type chunkedReader struct {
+	br   *bufio.Reader
+	resp *Response
+	dec  chunked.Decoder
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for !c.dec.Done() {
+		// Chunk data is read straight into p, the framing around it a line at a time
+		if c.dec.Remaining() > 0 {
+			n, err := c.br.Read(p[:min(int64(len(p)), c.dec.Remaining())])
+			c.dec.Decode(p[:n])
+			if err == io.EOF {
+				return n, io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+
+		line, err := readLine(c.br)
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, _, err := c.dec.Decode([]byte(line + "\r\n")); err != nil {
+			return 0, err
+		}
+	}
+
+	c.resp.Trailers = c.dec.Trailers
+	return 0, io.EOF
+}
@@ -0,0 +1,286 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/tracing"
+)
+
+const defaultDialTimeout = 30 * time.Second
+
+// RoundTripper sends a single request and returns its response, without following redirects.
+type RoundTripper interface {
+	RoundTrip(req *Request) (*Response, error)
+}
+
+// Transport opens a new connection for every request and closes it once the response body is closed.
+type Transport struct {
+	// DialTimeout limits connecting, including the TLS handshake, defaults to 30s
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for the response headers after the request is sent, 0 means no limit
+	ResponseHeaderTimeout time.Duration
+	// TLSConfig is used for https requests, ServerName defaults to the request's host
+	TLSConfig *tls.Config
+}
+
+// DefaultTransport is used by clients without a Transport.
+var DefaultTransport RoundTripper = &PooledTransport{}
+
+func (t *Transport) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context()
+
+	conn, err := t.dial(ctx, req)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	// Ask the server to close the connection after responding, unless
+	// the caller negotiates something else (e.g. an upgrade)
+	if !req.Headers.Has("Connection") {
+		req = req.clone()
+		req.Headers.Set("Connection", "close")
+	}
+
+	pc := newPersistConn(conn, "")
+	resp, err := roundTrip(ctx, pc, req, t.ResponseHeaderTimeout, func(pc *persistConn, reusable bool) error {
+		return pc.conn.Close()
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *Transport) dial(ctx context.Context, req *Request) (net.Conn, error) {
+	timeout := t.DialTimeout
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(req))
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "https" {
+		return conn, nil
+	}
+
+	config := &tls.Config{}
+	if t.TLSConfig != nil {
+		config = t.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = req.URL.Hostname()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// persistConn is a connection with its buffers, kept across requests when pooled.
+type persistConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	bw   *bufio.Writer
+	// key identifies the pool the connection belongs to
+	key string
+
+	reused    bool
+	idleTimer *time.Timer
+}
+
+func newPersistConn(conn net.Conn, key string) *persistConn {
+	return &persistConn{
+		conn: conn,
+		br:   bufio.NewReader(conn),
+		bw:   bufio.NewWriter(conn),
+		key:  key,
+	}
+}
+
+// noResponseError is returned when a request failed before any byte of the
+// response arrived, e.g. because the server had closed an idle connection.
+type noResponseError struct {
+	err error
+}
+
+func (e *noResponseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noResponseError) Unwrap() error {
+	return e.err
+}
+
+// roundTrip writes req to pc and reads the response headers. Cancelling ctx interrupts
+// any blocked read or write. Once the body is closed release is called with whether
+// the connection can carry another request, which is the case if the body was read to the end.
+// If ctx is part of a trace the attempt gets its own client span, which is propagated to the server.
+func roundTrip(ctx context.Context, pc *persistConn, req *Request, headerTimeout time.Duration,
+	release func(pc *persistConn, reusable bool) error) (*Response, error) {
+	ctx, span := tracing.StartChild(ctx, req.Method, tracing.SpanKindClient)
+	if span != nil {
+		req = req.clone()
+		tracing.Inject(ctx, req.Headers)
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.full", req.URL.String())
+		span.SetAttribute("server.address", req.URL.Hostname())
+		span.SetAttribute("http.request.body.size", len(req.Body))
+	}
+
+	resp, err := sendRequest(ctx, pc, req, headerTimeout, release, span)
+	if err != nil {
+		span.SetError(err.Error())
+		span.Finish()
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", int(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetError(resp.Reason)
+	}
+	if resp.StatusCode == response.SwitchingProtocols {
+		span.Finish()
+	}
+	return resp, nil
+}
+
+// sendRequest does the work of roundTrip, span is finished once the body is released.
+func sendRequest(ctx context.Context, pc *persistConn, req *Request, headerTimeout time.Duration,
+	release func(pc *persistConn, reusable bool) error, span *tracing.Span) (*Response, error) {
+	// Unblock reads and writes when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		pc.conn.SetDeadline(time.Now())
+	})
+	deadline, _ := ctx.Deadline()
+	pc.conn.SetDeadline(deadline)
+
+	err := req.write(pc.bw)
+	if err != nil {
+		stop()
+		return nil, contextError(ctx, &noResponseError{err: err})
+	}
+
+	if headerTimeout > 0 {
+		pc.conn.SetReadDeadline(earliest(deadline, time.Now().Add(headerTimeout)))
+	}
+	if _, err := pc.br.Peek(1); err != nil {
+		stop()
+		return nil, contextError(ctx, &noResponseError{err: err})
+	}
+	resp, err := readResponse(pc.br, req)
+	if err != nil {
+		stop()
+		return nil, contextError(ctx, err)
+	}
+	pc.conn.SetReadDeadline(deadline)
+
+	if resp.StatusCode == response.SwitchingProtocols {
+		// The connection now speaks another protocol, the context no longer applies
+		stop()
+		pc.conn.SetDeadline(time.Time{})
+		resp.Body = &upgradedConn{br: pc.br, Conn: pc.conn}
+		return resp, nil
+	}
+
+	reusable := !resp.Close && !hasToken(req.Headers.Get("Connection"), "close")
+	// Bodies that are known to be empty don't have to be read before the connection is reused
+	empty := noBody(req.Method, resp.StatusCode) || resp.ContentLength == 0
+	resp.Body = &body{ReadCloser: resp.Body, ctx: ctx, close: func(eof bool) error {
+		eof = eof || empty
+		if !stop() && ctx.Err() != nil {
+			// The context already interrupted the connection
+			eof = false
+		}
+		pc.conn.SetDeadline(time.Time{})
+		span.Finish()
+		return release(pc, reusable && eof)
+	}}
+	return resp, nil
+}
+
+// body reports context errors instead of the deadline errors they cause and
+// releases the connection once it's read to the end or closed.
+type body struct {
+	io.ReadCloser
+	ctx   context.Context
+	close func(eof bool) error
+	once  sync.Once
+	err   error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release(true)
+	} else if err != nil {
+		err = contextError(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	return b.release(false)
+}
+
+func (b *body) release(eof bool) error {
+	b.once.Do(func() {
+		b.err = b.close(eof)
+	})
+	return b.err
+}
+
+// upgradedConn is the body of a 101 response, bytes already buffered are read first.
+type upgradedConn struct {
+	br *bufio.Reader
+	net.Conn
+}
+
+func (u *upgradedConn) Read(p []byte) (int, error) {
+	return u.br.Read(p)
+}
+
+func hostPort(req *Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
+
+// contextError returns the context's error if it caused err.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// The connection deadline can fire just before the context notices its own
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) && errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
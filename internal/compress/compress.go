@@ -0,0 +1,120 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncoderFunc creates a writer that compresses into w.
+type EncoderFunc func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	mu sync.RWMutex
+	// encoders by content-coding, preference holds the registration order
+	// used to break ties between equally acceptable codings
+	encoders   = map[string]EncoderFunc{}
+	preference = []string{}
+)
+
+func init() {
+	RegisterEncoder("gzip", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	})
+	// "deflate" in HTTP is the zlib format (RFC 9110 Section 8.4.1.2)
+	RegisterEncoder("deflate", func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriterLevel(w, zlib.DefaultCompression)
+	})
+}
+
+// RegisterEncoder makes a content-coding available for response compression,
+// replacing any encoder already registered for it. Codings registered earlier
+// are preferred when the client accepts several with the same q-value.
+func RegisterEncoder(coding string, fn EncoderFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	coding = strings.ToLower(coding)
+	if _, ok := encoders[coding]; !ok {
+		preference = append(preference, coding)
+	}
+	encoders[coding] = fn
+}
+
+func encoder(coding string) (EncoderFunc, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	fn, ok := encoders[coding]
+	return fn, ok
+}
+
+func registeredCodings() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return slices.Clone(preference)
+}
+
+// Negotiate picks the best of the available codings for an Accept-Encoding value
+// (RFC 9110 Section 12.5.3). It returns "" if identity should be used.
+func Negotiate(acceptEncoding string, available []string) string {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		return ""
+	}
+
+	qvalues := map[string]float64{}
+	wildcard := -1.0
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		if coding == "*" {
+			wildcard = q
+		} else {
+			qvalues[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range available {
+		q, ok := qvalues[coding]
+		if !ok {
+			// x-gzip is an alias for gzip (RFC 9110 Section 8.4.1.3)
+			if coding == "gzip" {
+				q, ok = qvalues["x-gzip"]
+			}
+			if !ok {
+				q = max(wildcard, 0)
+			}
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	// Identity is always acceptable, but only wins when explicitly preferred
+	if q, ok := qvalues["identity"]; ok && q > bestQ {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,255 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	available := []string{"gzip", "deflate"}
+
+	assert.Equal(t, "", Negotiate("", available))
+	assert.Equal(t, "gzip", Negotiate("gzip, deflate", available))
+	assert.Equal(t, "gzip", Negotiate("deflate, gzip", available)) // Ties use server preference
+	assert.Equal(t, "deflate", Negotiate("gzip;q=0.5, deflate;q=0.8", available))
+	assert.Equal(t, "deflate", Negotiate("gzip;q=0, *", available))
+	assert.Equal(t, "gzip", Negotiate("*", available))
+	assert.Equal(t, "", Negotiate("br", available))
+	assert.Equal(t, "", Negotiate("gzip;q=0.5, identity", available))
+	assert.Equal(t, "gzip", Negotiate("x-gzip", available))
+	assert.Equal(t, "", Negotiate("gzip;q=0, deflate;q=0", available))
+}
+
+// serve runs handler through the middleware and returns the response headers and decoded body.
+func serve(t *testing.T, reqHeaders string, handler server.HandlerFunc) (map[string]string, string) {
+	method := "GET"
+	if strings.HasPrefix(reqHeaders, "HEAD ") {
+		method = "HEAD"
+		reqHeaders = strings.TrimPrefix(reqHeaders, "HEAD ")
+	}
+	req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n" + reqHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	require.Nil(t, Middleware(Options{})(handler)(w, req))
+	require.NoError(t, w.Close())
+
+	// Parse the raw response
+	reader := bufio.NewReader(buf)
+	statusLine, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	respHeaders := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, ": ")
+		respHeaders[key] = value
+	}
+
+	if method == "HEAD" || strings.HasPrefix(statusLine, "HTTP/1.1 304 ") {
+		rest, _ := io.ReadAll(reader)
+		return respHeaders, string(rest)
+	}
+
+	var body io.Reader = reader
+	if respHeaders["Transfer-Encoding"] == "chunked" {
+		body = dechunk(t, reader)
+	}
+	switch respHeaders["Content-Encoding"] {
+	case "gzip":
+		body, err = gzip.NewReader(body)
+		require.NoError(t, err)
+	case "deflate":
+		body, err = zlib.NewReader(body)
+		require.NoError(t, err)
+	}
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return respHeaders, string(data)
+}
+
+func dechunk(t *testing.T, r *bufio.Reader) io.Reader {
+	out := new(bytes.Buffer)
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		require.NoError(t, err)
+		if size == 0 {
+			return out
+		}
+		_, err = io.CopyN(out, r, size)
+		require.NoError(t, err)
+		_, err = r.Discard(2)
+		require.NoError(t, err)
+	}
+}
+
+var page = strings.Repeat("<p>hello compressed world</p>\n", 100)
+
+func writePage(contentType string) server.HandlerFunc {
+	return func(w *response.Writer, req *request.Request) error {
+		w.Headers = map[string]string{"Content-Type": contentType, "ETag": `"abc"`}
+		w.Write([]byte(page))
+		return nil
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	// Test: gzip
+	h, body := serve(t, "Accept-Encoding: gzip, deflate\r\n", writePage("text/html"))
+	assert.Equal(t, "gzip", h["Content-Encoding"])
+	assert.Equal(t, "chunked", h["Transfer-Encoding"])
+	assert.Equal(t, "Accept-Encoding", h["Vary"])
+	assert.Equal(t, `W/"abc"`, h["ETag"])
+	assert.Empty(t, h["Content-Length"])
+	assert.Equal(t, page, body)
+
+	// Test: deflate
+	h, body = serve(t, "Accept-Encoding: deflate\r\n", writePage("text/html"))
+	assert.Equal(t, "deflate", h["Content-Encoding"])
+	assert.Equal(t, page, body)
+
+	// Test: No Accept-Encoding, still varies
+	h, body = serve(t, "", writePage("text/html"))
+	assert.Empty(t, h["Content-Encoding"])
+	assert.Equal(t, "Accept-Encoding", h["Vary"])
+	assert.Equal(t, page, body)
+
+	// Test: Already compressed media types
+	h, _ = serve(t, "Accept-Encoding: gzip\r\n", writePage("image/png"))
+	assert.Empty(t, h["Content-Encoding"])
+	h, _ = serve(t, "Accept-Encoding: gzip\r\n", writePage("image/svg+xml"))
+	assert.Equal(t, "gzip", h["Content-Encoding"])
+
+	// Test: Tiny bodies
+	h, body = serve(t, "Accept-Encoding: gzip\r\n", func(w *response.Writer, req *request.Request) error {
+		w.Write([]byte("tiny"))
+		return nil
+	})
+	assert.Empty(t, h["Content-Encoding"])
+	assert.Equal(t, "4", h["Content-Length"])
+	assert.Equal(t, "tiny", body)
+
+	// Test: HEAD and 304 carry the same representation headers as GET
+	conditional := func(content string) server.HandlerFunc {
+		return func(w *response.Writer, req *request.Request) error {
+			w.Headers = map[string]string{"Content-Type": "text/html", "ETag": `"abc"`}
+			return response.ServeContent(w, req, strings.NewReader(content), time.Time{})
+		}
+	}
+	pick := func(h map[string]string, keys ...string) map[string]string {
+		picked := map[string]string{}
+		for _, key := range keys {
+			picked[key] = h[key]
+		}
+		return picked
+	}
+	representation := []string{"Content-Type", "Content-Encoding", "Content-Length", "Transfer-Encoding", "Vary", "ETag"}
+	validators := []string{"Content-Encoding", "Vary", "ETag"}
+	for _, content := range []string{page, "tiny"} {
+		get, _ := serve(t, "Accept-Encoding: gzip\r\n", conditional(content))
+		head, body := serve(t, "HEAD Accept-Encoding: gzip\r\n", conditional(content))
+		assert.Equal(t, pick(get, representation...), pick(head, representation...))
+		assert.Empty(t, body)
+
+		notModified, body := serve(t, "Accept-Encoding: gzip\r\nIf-None-Match: "+get["ETag"]+"\r\n", conditional(content))
+		assert.Equal(t, pick(get, validators...), pick(notModified, validators...))
+		assert.Empty(t, notModified["Content-Type"])
+		assert.Empty(t, notModified["Content-Length"])
+		assert.Empty(t, body)
+	}
+	get, _ := serve(t, "Accept-Encoding: gzip\r\n", conditional(page))
+	assert.Equal(t, "gzip", get["Content-Encoding"])
+	assert.Equal(t, `W/"abc"`, get["ETag"])
+	get, _ = serve(t, "Accept-Encoding: gzip\r\n", conditional("tiny"))
+	assert.Empty(t, get["Content-Encoding"])
+	assert.Equal(t, `"abc"`, get["ETag"])
+	assert.Equal(t, "Accept-Encoding", get["Vary"])
+}
+
+func decodeRequest(t *testing.T, contentEncoding string, body []byte, opts DecodeOptions) (string, string) {
+	raw := "POST /ingest HTTP/1.1\r\nHost: localhost\r\n" +
+		"Content-Encoding: " + contentEncoding + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + string(body)
+	req, err := request.HeadFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	var received string
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	handler := DecodeRequests(opts)(func(w *response.Writer, req *request.Request) error {
+		received = string(req.Body)
+		assert.Empty(t, req.Headers.Get("Content-Encoding"))
+		return nil
+	})
+	server.WriteError(w, req, handler(w, req))
+	require.NoError(t, w.Close())
+	return received, buf.String()
+}
+
+func TestDecodeRequests(t *testing.T) {
+	payload := strings.Repeat(`{"metric":"cpu","value":42}`, 50)
+
+	gzipped := new(bytes.Buffer)
+	gw := gzip.NewWriter(gzipped)
+	gw.Write([]byte(payload))
+	gw.Close()
+
+	zlibbed := new(bytes.Buffer)
+	zw := zlib.NewWriter(zlibbed)
+	zw.Write([]byte(payload))
+	zw.Close()
+
+	// Test: gzip and deflate bodies are decoded
+	received, _ := decodeRequest(t, "gzip", gzipped.Bytes(), DecodeOptions{})
+	assert.Equal(t, payload, received)
+	received, _ = decodeRequest(t, "deflate", zlibbed.Bytes(), DecodeOptions{})
+	assert.Equal(t, payload, received)
+
+	// Test: Unsupported coding
+	received, resp := decodeRequest(t, "br", []byte("x"), DecodeOptions{})
+	assert.Empty(t, received)
+	assert.Contains(t, resp, "415 Unsupported Media Type")
+	assert.Contains(t, resp, "Accept-Encoding: deflate, gzip, x-gzip\r\n")
+
+	// Test: Max decoded size
+	received, resp = decodeRequest(t, "gzip", gzipped.Bytes(), DecodeOptions{MaxDecodedSize: 100})
+	assert.Empty(t, received)
+	assert.Contains(t, resp, "413 Content Too Large")
+
+	// Test: Max encoded size, the body isn't read
+	received, resp = decodeRequest(t, "gzip", gzipped.Bytes(), DecodeOptions{MaxEncodedSize: 50})
+	assert.Empty(t, received)
+	assert.Contains(t, resp, "413 Content Too Large")
+
+	// Test: Max ratio, a few KB of zeros compress extremely well
+	bomb := new(bytes.Buffer)
+	bw := gzip.NewWriter(bomb)
+	bw.Write(make([]byte, 1<<20))
+	bw.Close()
+	_, resp = decodeRequest(t, "gzip", bomb.Bytes(), DecodeOptions{})
+	assert.Contains(t, resp, "413 Content Too Large")
+
+	// Test: Corrupt body
+	_, resp = decodeRequest(t, "gzip", []byte("not gzip"), DecodeOptions{})
+	assert.Contains(t, resp, "400 Bad Request")
+}
@@ -0,0 +1,182 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+// DecoderFunc creates a reader that decompresses r.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+var decoders = map[string]DecoderFunc{}
+
+func init() {
+	RegisterDecoder("gzip", func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	})
+	RegisterDecoder("x-gzip", func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	})
+	RegisterDecoder("deflate", func(r io.Reader) (io.ReadCloser, error) {
+		// Some clients send raw deflate instead of zlib, tell them apart by the zlib header
+		br := bufio.NewReader(r)
+		header, err := br.Peek(2)
+		if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	})
+}
+
+// RegisterDecoder makes a content-coding available for request body decoding,
+// replacing any decoder already registered for it.
+func RegisterDecoder(coding string, fn DecoderFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	decoders[strings.ToLower(coding)] = fn
+}
+
+func decoder(coding string) (DecoderFunc, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	fn, ok := decoders[coding]
+	return fn, ok
+}
+
+const (
+	defaultMaxDecodedSize = 10 << 20
+	defaultMaxRatio       = 100
+)
+
+type DecodeOptions struct {
+	// MaxEncodedSize caps the body as sent, which is read in full before
+	// decoding. Defaults to MaxDecodedSize
+	MaxEncodedSize int64
+	// MaxDecodedSize caps the decoded body size, defaults to 10 MiB
+	MaxDecodedSize int64
+	// MaxRatio caps decoded size / encoded size, defaults to 100
+	MaxRatio int64
+}
+
+var (
+	errUnsupportedCoding = errors.New("error: unsupported content-coding")
+	errTooLarge          = errors.New("error: decoded body too large")
+)
+
+// DecodeRequests transparently decodes request bodies sent with a Content-Encoding,
+// replacing req.Body with the decoded bytes. Unsupported codings are answered with
+// 415 Unsupported Media Type, bodies exceeding the limits with 413 Content Too Large.
+func DecodeRequests(opts DecodeOptions) func(next server.HandlerFunc) server.HandlerFunc {
+	if opts.MaxDecodedSize == 0 {
+		opts.MaxDecodedSize = defaultMaxDecodedSize
+	}
+	if opts.MaxRatio == 0 {
+		opts.MaxRatio = defaultMaxRatio
+	}
+	if opts.MaxEncodedSize == 0 {
+		opts.MaxEncodedSize = opts.MaxDecodedSize
+	}
+
+	return func(next server.HandlerFunc) server.HandlerFunc {
+		return func(w *response.Writer, req *request.Request) error {
+			contentEncoding := req.Headers.Get("Content-Encoding")
+			if contentEncoding == "" {
+				return next(w, req)
+			}
+
+			// Lower the server's limit so oversized bodies aren't even read
+			if limit := req.MaxBodySize(); limit == 0 || limit > opts.MaxEncodedSize {
+				req.SetMaxBodySize(opts.MaxEncodedSize)
+			}
+			body, err := req.ReadBody()
+			if err != nil {
+				return err
+			}
+			if int64(len(body)) > opts.MaxEncodedSize {
+				// Read before the limit was set, e.g. by an earlier middleware
+				return &server.HandleError{StatusCode: response.ContentTooLarge}
+			}
+
+			decoded, err := decodeBody(body, contentEncoding, opts)
+			switch {
+			case errors.Is(err, errUnsupportedCoding):
+				accept := headers.NewHeaders()
+				accept.Set("Accept-Encoding", strings.Join(decoderCodings(), ", "))
+				return &server.HandleError{StatusCode: response.UnsupportedMediaType, Headers: accept, Err: err}
+			case errors.Is(err, errTooLarge):
+				return &server.HandleError{StatusCode: response.ContentTooLarge, Err: err}
+			case err != nil:
+				return &server.HandleError{StatusCode: response.BadRequest, Err: err}
+			}
+
+			req.Body = decoded
+			req.Headers.Del("Content-Encoding")
+			req.Headers.Set("Content-Length", strconv.Itoa(len(decoded)))
+
+			return next(w, req)
+		}
+	}
+}
+
+// decodeBody undoes the codings listed in contentEncoding, last applied first.
+func decodeBody(body []byte, contentEncoding string, opts DecodeOptions) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	encodedLen := int64(max(len(body), 1))
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "identity" || coding == "" {
+			continue
+		}
+
+		fn, ok := decoder(coding)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedCoding, coding)
+		}
+		r, err := fn(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		// Read one byte past the limit to detect oversized bodies without buffering them
+		limit := min(opts.MaxDecodedSize, encodedLen*opts.MaxRatio)
+		body, err = io.ReadAll(io.LimitReader(r, limit+1))
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > limit {
+			return nil, errTooLarge
+		}
+	}
+
+	return body, nil
+}
+
+func decoderCodings() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	codings := []string{}
+	for coding := range decoders {
+		codings = append(codings, coding)
+	}
+	slices.Sort(codings)
+	return codings
+}
@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+// defaultMinSize is the smallest body worth compressing, smaller bodies
+// would barely shrink or even grow.
+const defaultMinSize = 1024
+
+type Options struct {
+	// MinSize skips compression of bodies known to be smaller, defaults to 1024 bytes
+	MinSize int
+	// Codings restricts and orders the registered codings to offer, defaults to all
+	Codings []string
+}
+
+// incompressibleTypes are media types (or prefixes ending in "/") that
+// are already compressed, compressing them again only costs CPU.
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+	"application/x-xz", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/zstd", "application/pdf", "application/wasm",
+	"font/woff", "font/woff2",
+}
+
+// compressibleImages are image types that are text based and compress well.
+var compressibleImages = []string{"image/svg+xml", "image/x-icon", "image/bmp"}
+
+// Middleware compresses response bodies using the best coding the client accepts.
+func Middleware(opts Options) func(next server.HandlerFunc) server.HandlerFunc {
+	if opts.MinSize == 0 {
+		opts.MinSize = defaultMinSize
+	}
+
+	return func(next server.HandlerFunc) server.HandlerFunc {
+		return func(w *response.Writer, req *request.Request) error {
+			codings := opts.Codings
+			if len(codings) == 0 {
+				codings = registeredCodings()
+			}
+			coding := Negotiate(req.Headers.Get("Accept-Encoding"), codings)
+
+			// HEAD and 304 responses get here too, so they carry the same
+			// Vary, Content-Encoding and ETag as the full response
+			w.SetBodyEncoder(func(w *response.Writer, contentLength int, dst io.Writer) io.WriteCloser {
+				// The response depends on Accept-Encoding whether or not we compress
+				addVary(w, "Accept-Encoding")
+				if coding == "" || !compressible(w, contentLength, opts.MinSize) {
+					return nil
+				}
+
+				fn, ok := encoder(coding)
+				if !ok {
+					return nil
+				}
+				enc, err := fn(dst)
+				if err != nil {
+					log.Println("error: creating", coding, "encoder failed:", err)
+					return nil
+				}
+
+				w.Headers.Set("Content-Encoding", coding)
+				// The encoded bytes differ, so a strong validator no longer holds
+				if etag := w.Headers.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+					w.Headers.Set("ETag", "W/"+etag)
+				}
+				return enc
+			})
+
+			return next(w, req)
+		}
+	}
+}
+
+// compressible reports whether the response about to be committed should be compressed.
+func compressible(w *response.Writer, contentLength int, minSize int) bool {
+	if w.Status == response.PartialContent || w.Headers.Get("Content-Range") != "" {
+		return false // Ranges refer to the identity representation
+	}
+	if w.Headers.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(w.Headers.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	// Known small bodies, with a handler supplied length or buffered entirely.
+	// The supplied length wins, HEAD handlers may declare it without writing
+	size := contentLength
+	if declared, err := strconv.Atoi(w.Headers.Get("Content-Length")); err == nil {
+		size = declared
+	}
+	if size >= 0 && size < minSize {
+		return false
+	}
+
+	mediaType, _, _ := strings.Cut(strings.ToLower(w.Headers.Get("Content-Type")), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, t := range compressibleImages {
+		if mediaType == t {
+			return true
+		}
+	}
+	for _, t := range incompressibleTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return false
+		}
+	}
+	return true
+}
+
+func addVary(w *response.Writer, field string) {
+	vary := w.Headers.Get("Vary")
+	for _, v := range strings.Split(vary, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.EqualFold(v, field) {
+			return
+		}
+	}
+	if vary == "" {
+		w.Headers.Set("Vary", field)
+	} else {
+		w.Headers.Set("Vary", vary+", "+field)
+	}
+}
@@ -0,0 +1,195 @@
+package cookie
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/headers"
+)
+
+// SameSite is the value of the SameSite cookie attribute.
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is an HTTP cookie as sent in a Cookie request header or
+// a Set-Cookie response header (RFC 6265).
+type Cookie struct {
+	Name  string
+	Value string
+
+	// Attributes, only used for Set-Cookie
+	Expires     time.Time
+	MaxAge      int // 0 means unset, < 0 means delete now ("Max-Age=0")
+	Domain      string
+	Path        string
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse parses the value of a Cookie request header into name/value pairs.
+// Malformed pairs are skipped, matching how browsers treat them.
+func Parse(value string) []*Cookie {
+	cookies := []*Cookie{}
+
+	// Pairs are separated by ';' only (RFC 6265 Section 4.2.1), headers.Parse
+	// joins multiple Cookie lines with "; " too
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, val, _ := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		val = strings.TrimSpace(val)
+		if !isToken(name) {
+			continue
+		}
+		val, ok := parseValue(val)
+		if !ok {
+			continue
+		}
+
+		cookies = append(cookies, &Cookie{Name: name, Value: val})
+	}
+
+	return cookies
+}
+
+// Validate checks the cookie's name, value and attributes for use in a Set-Cookie header.
+func (c *Cookie) Validate() error {
+	if !isToken(c.Name) {
+		return fmt.Errorf("error: invalid cookie name: %q", c.Name)
+	}
+	if _, ok := parseValue(c.Value); !ok {
+		return fmt.Errorf("error: invalid cookie value for %q", c.Name)
+	}
+	if c.Domain != "" && !isValidDomain(c.Domain) {
+		return fmt.Errorf("error: invalid cookie domain: %q", c.Domain)
+	}
+	for i := 0; i < len(c.Path); i++ {
+		if c.Path[i] < 0x20 || c.Path[i] == 0x7f || c.Path[i] == ';' {
+			return fmt.Errorf("error: invalid cookie path: %q", c.Path)
+		}
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return fmt.Errorf("error: cookie %q has SameSite=None without Secure", c.Name)
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("error: cookie %q is Partitioned without Secure", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return fmt.Errorf("error: cookie %q requires Secure", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Domain != "" || c.Path != "/") {
+		return fmt.Errorf("error: cookie %q requires Secure, Path=/ and no Domain", c.Name)
+	}
+
+	return nil
+}
+
+// String returns the serialization of the cookie for a Set-Cookie header.
+// It doesn't validate the cookie, call Validate first.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(headers.TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String()
+}
+
+// parseValue strips optional surrounding quotes and checks
+// that the value only contains cookie-octets.
+func parseValue(value string) (string, bool) {
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		// cookie-octet = %x21 / %x23-2B / %x2D-3A / %x3C-5B / %x5D-7E
+		if c < 0x21 || c > 0x7e || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') &&
+			!strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
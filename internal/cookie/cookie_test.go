@@ -0,0 +1,69 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Standard Cookie header
+	cookies := Parse("session=abc123; theme=dark")
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc123", cookies[0].Value)
+	assert.Equal(t, "theme", cookies[1].Name)
+	assert.Equal(t, "dark", cookies[1].Value)
+
+	// Test: Quoted value and value containing '='
+	cookies = Parse(`a="quoted"; b=x=y`)
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "quoted", cookies[0].Value)
+	assert.Equal(t, "x=y", cookies[1].Value)
+
+	// Test: Commas don't separate pairs
+	cookies = Parse("a=1, b=2; c=3")
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "c", cookies[0].Name)
+
+	// Test: Malformed pairs are skipped
+	cookies = Parse(`bad name=1; ok=2; bad="val\ue"; ;`)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ok", cookies[0].Name)
+}
+
+func TestString(t *testing.T) {
+	c := &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Expires:     time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Domain:      ".example.com",
+		Path:        "/docs",
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, "id=a3fWa; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=3600; Domain=example.com; Path=/docs; Secure; HttpOnly; SameSite=None; Partitioned", c.String())
+
+	// Test: Deleting a cookie
+	c = &Cookie{Name: "id", MaxAge: -1}
+	assert.Equal(t, "id=; Max-Age=0", c.String())
+}
+
+func TestValidate(t *testing.T) {
+	require.Error(t, (&Cookie{Name: "", Value: "x"}).Validate())
+	require.Error(t, (&Cookie{Name: "a b", Value: "x"}).Validate())
+	require.Error(t, (&Cookie{Name: "a", Value: "x;y"}).Validate())
+	require.Error(t, (&Cookie{Name: "a", Value: "x y"}).Validate())
+	require.Error(t, (&Cookie{Name: "a", Value: "x", Domain: "exa mple.com"}).Validate())
+	require.Error(t, (&Cookie{Name: "a", Value: "x", Path: "/a;b"}).Validate())
+	require.Error(t, (&Cookie{Name: "a", Value: "x", SameSite: SameSiteNone}).Validate())
+	require.Error(t, (&Cookie{Name: "a", Value: "x", Partitioned: true}).Validate())
+	require.Error(t, (&Cookie{Name: "__Host-a", Value: "x", Secure: true, Path: "/docs"}).Validate())
+	require.NoError(t, (&Cookie{Name: "__Host-a", Value: "x", Secure: true, Path: "/"}).Validate())
+}
@@ -0,0 +1,296 @@
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+// sniffLen is how many bytes are used for content sniffing.
+const sniffLen = 512
+
+type Options struct {
+	// Prefix is stripped from the request target before looking up files, e.g. "/static/"
+	Prefix string
+	// Index is the file served for directories, defaults to "index.html"
+	Index string
+	// Listing renders directory listings for directories without an index file
+	Listing bool
+	// AllowDotfiles serves files and directories whose name starts with "."
+	AllowDotfiles bool
+	// SPAFallback is served instead of a 404 for paths that don't exist,
+	// e.g. "index.html" for single page apps with client-side routing
+	SPAFallback string
+}
+
+// Dir returns an fs.FS for the directory tree rooted at dir, symlinks can't
+// lead out of it. If dir can't be opened, opening any file fails with that error.
+func Dir(dir string) fs.FS {
+	root, err := os.OpenRoot(filepath.Clean(dir))
+	if err != nil {
+		return errFS{err: err}
+	}
+	return root.FS()
+}
+
+// errFS fails every Open with err.
+type errFS struct {
+	err error
+}
+
+func (e errFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: e.err}
+}
+
+// New returns a HandlerFunc serving files from fsys.
+func New(fsys fs.FS, opts Options) server.HandlerFunc {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+
+	return func(w *response.Writer, req *request.Request) error {
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			allow := headers.NewHeaders()
+			allow.Set("Allow", "GET, HEAD")
+			return &server.HandleError{StatusCode: response.MethodNotAllowed, Headers: allow}
+		}
+
+		urlPath, ok := cleanPath(req.RequestLine.RequestTarget, opts.Prefix)
+		if !ok {
+			return &server.HandleError{StatusCode: response.NotFound}
+		}
+		if !opts.AllowDotfiles && hasDotSegment(urlPath) {
+			return &server.HandleError{StatusCode: response.NotFound}
+		}
+
+		name := strings.Trim(urlPath, "/")
+		if name == "" {
+			name = "."
+		}
+
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			if opts.SPAFallback != "" && isNotFound(err) {
+				return serveFile(w, req, fsys, opts.SPAFallback)
+			}
+			return fsError(err)
+		}
+
+		if !info.IsDir() {
+			return serveFile(w, req, fsys, name)
+		}
+
+		// Directories are served with a trailing slash so relative links resolve.
+		// The Location is built from the cleaned path, "//host" would leave the site
+		if !strings.HasSuffix(urlPath, "/") {
+			target := (&url.URL{Path: strings.TrimSuffix(opts.Prefix, "/") + urlPath + "/"}).EscapedPath()
+			if _, query, ok := strings.Cut(req.RequestLine.RequestTarget, "?"); ok {
+				target += "?" + query
+			}
+			location := headers.NewHeaders()
+			location.Set("Location", target)
+			return &server.HandleError{StatusCode: response.MovedPermanently, Headers: location}
+		}
+
+		index := path.Join(name, opts.Index)
+		if _, err := fs.Stat(fsys, index); err == nil {
+			return serveFile(w, req, fsys, index)
+		}
+
+		if !opts.Listing {
+			return &server.HandleError{StatusCode: response.Forbidden}
+		}
+		return serveListing(w, fsys, name, urlPath, opts.AllowDotfiles)
+	}
+}
+
+// ServeFile serves the single file name from fsys, e.g. for mapping a fixed
+// route to a file. Errors are returned as *server.HandleError for the handler to return.
+func ServeFile(w *response.Writer, req *request.Request, fsys fs.FS, name string) error {
+	if !fs.ValidPath(name) {
+		return &server.HandleError{StatusCode: response.NotFound}
+	}
+	return serveFile(w, req, fsys, name)
+}
+
+func serveFile(w *response.Writer, req *request.Request, fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fsError(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fsError(err)
+	}
+	if info.IsDir() {
+		return &server.HandleError{StatusCode: response.NotFound}
+	}
+
+	if w.Headers == nil {
+		w.Headers = headers.NewHeaders()
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Headers.Set("Content-Type", contentType)
+	}
+
+	if w.Headers.Get("ETag") == "" {
+		w.Headers.Set("ETag", response.FileETag(info.Size(), info.ModTime()))
+	}
+
+	// Seekable files support conditional and Range requests, ServeContent sniffs the type if needed
+	if content, ok := f.(io.ReadSeeker); ok {
+		return response.ServeContent(w, req, content, info.ModTime())
+	}
+
+	w.Headers.Set("Last-Modified", info.ModTime().UTC().Format(headers.TimeFormat))
+	w.Headers.Set("Content-Length", fmt.Sprint(info.Size()))
+
+	// Sniff the content type if the extension doesn't give it away,
+	// keeping the sniffed bytes to send them ahead of the rest of the file
+	var body io.Reader = f
+	if w.Headers.Get("Content-Type") == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fsError(err)
+		}
+		w.Headers.Set("Content-Type", http.DetectContentType(buf[:n]))
+		body = io.MultiReader(bytes.NewReader(buf[:n]), f)
+	}
+
+	if w.IsHead() {
+		return nil
+	}
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func serveListing(w *response.Writer, fsys fs.FS, name string, urlPath string, allowDotfiles bool) error {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return fsError(err)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	var b strings.Builder
+	title := html.EscapeString(urlPath)
+	fmt.Fprintf(&b, "<html>\n  <head>\n    <title>Index of %s</title>\n  </head>\n  <body>\n    <h1>Index of %s</h1>\n    <ul>\n", title, title)
+	if urlPath != "/" {
+		b.WriteString("      <li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if !allowDotfiles && strings.HasPrefix(entryName, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := (&url.URL{Path: entryName}).EscapedPath()
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	b.WriteString("    </ul>\n  </body>\n</html>\n")
+
+	w.Headers = headers.NewHeaders()
+	w.Headers.Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
+
+// cleanPath extracts the path from target, strips prefix, decodes it and
+// resolves "." and ".." segments. It reports false for paths that can't be served.
+func cleanPath(target string, prefix string) (string, bool) {
+	target, _, _ = strings.Cut(target, "?")
+	target, _, _ = strings.Cut(target, "#")
+	if !strings.HasPrefix(target, "/") {
+		return "", false
+	}
+
+	if prefix != "" {
+		trimmed, ok := strings.CutPrefix(target, strings.TrimSuffix(prefix, "/"))
+		// The prefix must end at a segment boundary, "/assetsx" isn't under "/assets/"
+		if !ok || (trimmed != "" && trimmed[0] != '/') {
+			return "", false
+		}
+		target = trimmed
+		if target == "" {
+			target = "/"
+		}
+	}
+
+	decoded, err := url.PathUnescape(target)
+	if err != nil {
+		return "", false
+	}
+	// Backslashes and NULs could escape the root or confuse the OS on some platforms
+	if strings.ContainsAny(decoded, "\\\x00") {
+		return "", false
+	}
+
+	cleaned := path.Clean("/" + decoded)
+	if cleaned != "/" && strings.HasSuffix(decoded, "/") {
+		cleaned += "/"
+	}
+	if !fs.ValidPath(strings.Trim(cleaned, "/")) && cleaned != "/" {
+		return "", false
+	}
+	return cleaned, true
+}
+
+func hasDotSegment(urlPath string) bool {
+	for _, segment := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound reports whether err means the path doesn't name a file, e.g.
+// because a parent is a regular file ("/a.txt/b") or the name is too long.
+func isNotFound(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) ||
+		errors.Is(err, syscall.ENOTDIR) || errors.Is(err, syscall.ENAMETOOLONG)
+}
+
+// isOutsideRoot reports whether err is from a symlink leading out of a Dir,
+// os.Root doesn't export the error it returns for those.
+func isOutsideRoot(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && pathErr.Err.Error() == "path escapes from parent"
+}
+
+// fsError maps an error of accessing the file system to the response status.
+func fsError(err error) error {
+	switch {
+	case isNotFound(err) || isOutsideRoot(err):
+		return &server.HandleError{StatusCode: response.NotFound, Err: err}
+	case os.IsPermission(err):
+		return &server.HandleError{StatusCode: response.Forbidden, Err: err}
+	default:
+		return &server.HandleError{StatusCode: response.InternalServerErrror, Err: err}
+	}
+}
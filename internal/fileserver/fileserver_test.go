@@ -0,0 +1,148 @@
+package fileserver
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"index.html":      {Data: []byte("<html>home</html>"), ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	"app.js":          {Data: []byte("console.log(1)")},
+	"data":            {Data: []byte("%PDF-1.4 rest of file")},
+	"docs/readme.txt": {Data: []byte("read me")},
+	"docs/.secret":    {Data: []byte("hidden")},
+	".env":            {Data: []byte("TOKEN=1")},
+	"empty/.keep":     {Data: []byte("")},
+}
+
+func serve(t *testing.T, opts Options, method string, target string) string {
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	server.WriteError(w, req, New(testFS, opts)(w, req))
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestServeFiles(t *testing.T) {
+	// Test: Index file with Last-Modified
+	resp := serve(t, Options{}, "GET", "/")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, resp, "Last-Modified: Tue, 02 Jan 2024 03:04:05 GMT\r\n")
+	assert.Contains(t, resp, "Content-Length: 17\r\n")
+	assert.True(t, strings.HasSuffix(resp, "<html>home</html>"))
+
+	// Test: Content-Type by extension and by sniffing
+	assert.Contains(t, serve(t, Options{}, "GET", "/app.js"), "Content-Type: text/javascript; charset=utf-8\r\n")
+	resp = serve(t, Options{}, "GET", "/data")
+	assert.Contains(t, resp, "Content-Type: application/pdf\r\n")
+	assert.True(t, strings.HasSuffix(resp, "%PDF-1.4 rest of file"))
+
+	// Test: HEAD sends headers only
+	resp = serve(t, Options{}, "HEAD", "/app.js")
+	assert.Contains(t, resp, "Content-Length: 14\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: Prefix and percent-encoding
+	assert.Contains(t, serve(t, Options{Prefix: "/static/"}, "GET", "/static/docs/read%6De.txt"), "read me")
+	assert.Contains(t, serve(t, Options{Prefix: "/static/"}, "GET", "/other/app.js"), "404 Not Found")
+	assert.Contains(t, serve(t, Options{Prefix: "/static/"}, "GET", "/staticapp.js"), "404 Not Found")
+	assert.Contains(t, serve(t, Options{Prefix: "/static/"}, "GET", "/static"), "<html>home</html>")
+
+	// Test: The file's entity tag is strong, so If-Range can match it
+	etag := response.FileETag(17, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	req, err := request.RequestFromReader(strings.NewReader("GET /index.html HTTP/1.1\r\nHost: localhost\r\nRange: bytes=0-5\r\nIf-Range: " + etag + "\r\n\r\n"))
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	require.NoError(t, New(testFS, Options{})(w, req))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, buf.String(), "ETag: "+etag+"\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n<html>"))
+
+	// Test: Method not allowed
+	resp = serve(t, Options{}, "POST", "/app.js")
+	assert.Contains(t, resp, "405 Method Not Allowed")
+	assert.Contains(t, resp, "Allow: GET, HEAD\r\n")
+}
+
+func TestServeDirectories(t *testing.T) {
+	// Test: Redirect to trailing slash
+	resp := serve(t, Options{}, "GET", "/docs?x=1")
+	assert.Contains(t, resp, "301 Moved Permanently")
+	assert.Contains(t, resp, "Location: /docs/?x=1\r\n")
+	assert.Contains(t, serve(t, Options{Prefix: "/static/"}, "GET", "/static/docs"), "Location: /static/docs/\r\n")
+
+	// Test: The redirect can't point at another host
+	assert.Contains(t, serve(t, Options{}, "GET", "//docs"), "Location: /docs/\r\n")
+
+	// Test: No listing by default
+	assert.Contains(t, serve(t, Options{}, "GET", "/docs/"), "403 Forbidden")
+
+	// Test: Listing hides dotfiles
+	resp = serve(t, Options{Listing: true}, "GET", "/docs/")
+	assert.Contains(t, resp, `<a href="readme.txt">readme.txt</a>`)
+	assert.NotContains(t, resp, ".secret")
+
+	// Test: SPA fallback
+	resp = serve(t, Options{SPAFallback: "index.html"}, "GET", "/some/client/route")
+	assert.Contains(t, resp, "200 OK")
+	assert.Contains(t, resp, "<html>home</html>")
+}
+
+func TestServeBlocked(t *testing.T) {
+	// Test: Dotfiles
+	assert.Contains(t, serve(t, Options{}, "GET", "/.env"), "404 Not Found")
+	assert.Contains(t, serve(t, Options{}, "GET", "/docs/.secret"), "404 Not Found")
+	assert.Contains(t, serve(t, Options{AllowDotfiles: true}, "GET", "/.env"), "TOKEN=1")
+
+	// Test: Traversal can't escape the root
+	assert.Contains(t, serve(t, Options{}, "GET", "/../../etc/passwd"), "404 Not Found")
+	assert.Contains(t, serve(t, Options{}, "GET", "/docs/..%2F..%2F.env"), "404 Not Found")
+	assert.Contains(t, serve(t, Options{}, "GET", "/docs/%2e%2e/app.js"), "console.log(1)")
+	assert.Contains(t, serve(t, Options{}, "GET", "/docs%5C..%5Capp.js"), "404 Not Found")
+
+	// Test: A file used as a directory isn't found
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644))
+	req, err := request.RequestFromReader(strings.NewReader("GET /a.txt/foo HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	server.WriteError(w, req, New(Dir(dir), Options{})(w, req))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Symlinks can't lead out of the root
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("outside"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link.txt")))
+	req, err = request.RequestFromReader(strings.NewReader("GET /link.txt HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	buf = new(bytes.Buffer)
+	w = response.NewWriter(buf, req)
+	server.WriteError(w, req, New(Dir(dir), Options{})(w, req))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 Not Found\r\n"))
+	assert.NotContains(t, buf.String(), "outside")
+
+	// Test: A root that can't be opened serves nothing
+	_, err = Dir(filepath.Join(dir, "missing")).Open("a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
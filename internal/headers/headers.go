@@ -7,6 +7,9 @@ import (
 	"strings"
 )
 
+// TimeFormat is the IMF-fixdate format used for HTTP dates (RFC 9110 Section 5.6.7).
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
 type Headers map[string]string
 
 func NewHeaders() Headers {
@@ -42,7 +45,7 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	// Validate key
 	allowed := []string{"!", "#", "$", "%", "&", "'", "*", "+", "-", ".", "^", "_", "`", "|", "~"}
 	for _, char := range key {
-		if (char < 'a' || char > 'z') && (char < 'A' || char > 'Z') {
+		if (char < 'a' || char > 'z') && (char < 'A' || char > 'Z') && (char < '0' || char > '9') {
 			if !slices.Contains(allowed, string(char)) {
 				return 0, false, fmt.Errorf("invalid character in header name: %q", char)
 			}
@@ -51,7 +54,11 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	// Append to existing header or set new one
 	if existing, ok := h[key]; ok {
-		h[key] = existing + ", " + value // RFC 7230: Combine with comma
+		if key == "cookie" {
+			h[key] = existing + "; " + value // Cookie pairs are separated by semicolons
+		} else {
+			h[key] = existing + ", " + value // RFC 7230: Combine with comma
+		}
 	} else {
 		h[key] = value
 	}
@@ -68,7 +75,43 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 // Get gets the corresponding value of the key from h.
 func (h Headers) Get(key string) string {
-	return h[strings.ToLower(key)]
+	if value, ok := h[strings.ToLower(key)]; ok {
+		return value
+	}
+
+	// Headers set directly on the map (e.g. GetDefaultHeaders) may use any casing
+	for k, value := range h {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// Has reports whether h contains the key, regardless of casing.
+func (h Headers) Has(key string) bool {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set sets the key to value, replacing any existing value stored under a different casing.
+func (h Headers) Set(key string, value string) {
+	h.Del(key)
+	h[key] = value
+}
+
+// Del deletes the key from h, regardless of casing.
+func (h Headers) Del(key string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
 }
 
 // Replace replaces the old value of the key with the new one
@@ -90,3 +133,26 @@ func (h Headers) Replace(key string, value string) string {
 
 	return ""
 }
+
+// forbiddenTrailers are fields that must not be sent in, or merged from, trailers
+// because they're needed for framing, routing, authentication or response handling
+// before the body is processed (RFC 9110 Section 6.5.1).
+var forbiddenTrailers = []string{
+	// Message framing
+	"transfer-encoding", "content-length", "trailer",
+	// Routing
+	"host",
+	// Request modifiers
+	"cache-control", "expect", "max-forwards", "pragma", "range", "te",
+	"if-match", "if-none-match", "if-modified-since", "if-unmodified-since", "if-range",
+	// Authentication
+	"authorization", "proxy-authenticate", "proxy-authorization", "www-authenticate", "set-cookie", "cookie",
+	// Response control and content
+	"age", "date", "expires", "location", "retry-after", "vary", "warning",
+	"content-encoding", "content-type", "content-range",
+}
+
+// IsForbiddenTrailer reports whether the field named key may not appear in a trailer section.
+func IsForbiddenTrailer(key string) bool {
+	return slices.Contains(forbiddenTrailers, strings.ToLower(key))
+}
@@ -97,3 +97,13 @@ func TestMultipleFieldValues(t *testing.T) {
 	require.Equal(t, 1, len(headers))
 	require.True(t, done)
 }
+
+func TestDigitsInName(t *testing.T) {
+	headers := NewHeaders()
+	data := []byte("X-Content-SHA256: abc\r\n")
+	n, done, err := headers.Parse(data)
+	require.Nil(t, err)
+	require.Equal(t, len(data), n)
+	require.False(t, done)
+	require.Equal(t, "abc", headers["x-content-sha256"])
+}
@@ -0,0 +1,668 @@
+package headers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements Structured Field Values for HTTP (RFC 8941, updated
+// by RFC 9651 for Dates). Bare items are represented with plain Go types:
+//
+//	Integer       int64
+//	Decimal       float64
+//	String        string
+//	Token         Token
+//	Byte Sequence []byte
+//	Boolean       bool
+//	Date          time.Time
+
+// Token is a Structured Field token, kept distinct from String so that
+// serialization round-trips.
+type Token string
+
+// Param is a single key/value parameter attached to an Item or InnerList.
+type Param struct {
+	Key   string
+	Value any
+}
+
+// Params is an ordered set of parameters.
+type Params []Param
+
+// Item is a bare item with parameters.
+type Item struct {
+	Value  any
+	Params Params
+}
+
+// InnerList is a parenthesized list of Items with its own parameters.
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+// List is a Structured Field List. Each member is either an Item or an InnerList.
+type List []any
+
+// DictMember is a single member of a Dictionary. Member is either an Item or an InnerList.
+type DictMember struct {
+	Key    string
+	Member any
+}
+
+// Dictionary is an ordered Structured Field Dictionary.
+type Dictionary []DictMember
+
+// Get returns the value of the parameter named key.
+func (p Params) Get(key string) (any, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set adds or overwrites a parameter, keeping the original position on overwrite.
+func (p Params) set(key string, value any) Params {
+	for i := range p {
+		if p[i].Key == key {
+			p[i].Value = value
+			return p
+		}
+	}
+	return append(p, Param{Key: key, Value: value})
+}
+
+// Get returns the member named key.
+func (d Dictionary) Get(key string) (any, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Member, true
+		}
+	}
+	return nil, false
+}
+
+func (d Dictionary) set(key string, member any) Dictionary {
+	for i := range d {
+		if d[i].Key == key {
+			d[i].Member = member
+			return d
+		}
+	}
+	return append(d, DictMember{Key: key, Member: member})
+}
+
+// ParseItem parses a field value as a Structured Field Item.
+func ParseItem(value string) (Item, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	item, err := p.parseItem()
+	if err != nil {
+		return Item{}, err
+	}
+	p.skipSP()
+	if !p.eof() {
+		return Item{}, p.errorf("trailing characters")
+	}
+	return item, nil
+}
+
+// ParseList parses a field value as a Structured Field List.
+func ParseList(value string) (List, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	list := List{}
+	for !p.eof() {
+		member, err := p.parseItemOrInnerList()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, member)
+
+		p.skipOWS()
+		if p.eof() {
+			return list, nil
+		}
+		if p.s[p.i] != ',' {
+			return nil, p.errorf("expected comma")
+		}
+		p.i++
+		p.skipOWS()
+		if p.eof() {
+			return nil, p.errorf("trailing comma")
+		}
+	}
+	return list, nil
+}
+
+// ParseDictionary parses a field value as a Structured Field Dictionary.
+// Duplicate keys keep their first position and their last value.
+func ParseDictionary(value string) (Dictionary, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	dict := Dictionary{}
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		var member any
+		if !p.eof() && p.s[p.i] == '=' {
+			p.i++
+			member, err = p.parseItemOrInnerList()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			params, err := p.parseParams()
+			if err != nil {
+				return nil, err
+			}
+			member = Item{Value: true, Params: params}
+		}
+		dict = dict.set(key, member)
+
+		p.skipOWS()
+		if p.eof() {
+			return dict, nil
+		}
+		if p.s[p.i] != ',' {
+			return nil, p.errorf("expected comma")
+		}
+		p.i++
+		p.skipOWS()
+		if p.eof() {
+			return nil, p.errorf("trailing comma")
+		}
+	}
+	return dict, nil
+}
+
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *sfParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("structured field: %s at offset %d", fmt.Sprintf(format, args...), p.i)
+}
+
+func (p *sfParser) skipSP() {
+	for !p.eof() && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for !p.eof() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *sfParser) parseItemOrInnerList() (any, error) {
+	if !p.eof() && p.s[p.i] == '(' {
+		return p.parseInnerList()
+	}
+	return p.parseItem()
+}
+
+func (p *sfParser) parseInnerList() (InnerList, error) {
+	p.i++ // Skip "("
+	inner := InnerList{Items: []Item{}}
+	for !p.eof() {
+		p.skipSP()
+		if !p.eof() && p.s[p.i] == ')' {
+			p.i++
+			params, err := p.parseParams()
+			if err != nil {
+				return InnerList{}, err
+			}
+			inner.Params = params
+			return inner, nil
+		}
+
+		item, err := p.parseItem()
+		if err != nil {
+			return InnerList{}, err
+		}
+		inner.Items = append(inner.Items, item)
+
+		if p.eof() || (p.s[p.i] != ' ' && p.s[p.i] != ')') {
+			return InnerList{}, p.errorf("expected space or ')' in inner list")
+		}
+	}
+	return InnerList{}, p.errorf("unterminated inner list")
+}
+
+func (p *sfParser) parseItem() (Item, error) {
+	value, err := p.parseBareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: value, Params: params}, nil
+}
+
+func (p *sfParser) parseParams() (Params, error) {
+	params := Params{}
+	for !p.eof() && p.s[p.i] == ';' {
+		p.i++
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		var value any = true
+		if !p.eof() && p.s[p.i] == '=' {
+			p.i++
+			value, err = p.parseBareItem()
+			if err != nil {
+				return nil, err
+			}
+		}
+		params = params.set(key, value)
+	}
+	return params, nil
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	if p.eof() || !(isLCAlpha(p.s[p.i]) || p.s[p.i] == '*') {
+		return "", p.errorf("invalid key")
+	}
+	start := p.i
+	for !p.eof() && isKeyChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) parseBareItem() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end of input")
+	}
+
+	c := p.s[p.i]
+	switch {
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlpha(c):
+		return p.parseToken()
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	case c == '@':
+		return p.parseDate()
+	default:
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *sfParser) parseNumber() (any, error) {
+	isDecimal := false
+	start := p.i
+	if p.s[p.i] == '-' {
+		p.i++
+	}
+	if p.eof() || !isDigit(p.s[p.i]) {
+		return nil, p.errorf("expected digit")
+	}
+
+	digits := 0
+	for !p.eof() {
+		c := p.s[p.i]
+		if isDigit(c) {
+			digits++
+		} else if c == '.' && !isDecimal {
+			if digits > 12 {
+				return nil, p.errorf("decimal integer part too long")
+			}
+			isDecimal = true
+			digits = 0
+		} else {
+			break
+		}
+		p.i++
+
+		if !isDecimal && digits > 15 {
+			return nil, p.errorf("integer too long")
+		}
+		if isDecimal && digits > 3 {
+			return nil, p.errorf("decimal fraction too long")
+		}
+	}
+
+	num := p.s[start:p.i]
+	if !isDecimal {
+		return strconv.ParseInt(num, 10, 64)
+	}
+	if num[len(num)-1] == '.' {
+		return nil, p.errorf("decimal ends with '.'")
+	}
+	return strconv.ParseFloat(num, 64)
+}
+
+func (p *sfParser) parseString() (string, error) {
+	p.i++ // Skip opening DQUOTE
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated escape")
+			}
+			next := p.s[p.i]
+			if next != '"' && next != '\\' {
+				return "", p.errorf("invalid escape %q", next)
+			}
+			b.WriteByte(next)
+			p.i++
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid string character %q", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *sfParser) parseToken() (Token, error) {
+	start := p.i
+	p.i++
+	for !p.eof() && (isTChar(p.s[p.i]) || p.s[p.i] == ':' || p.s[p.i] == '/') {
+		p.i++
+	}
+	return Token(p.s[start:p.i]), nil
+}
+
+func (p *sfParser) parseByteSequence() ([]byte, error) {
+	p.i++ // Skip opening ":"
+	end := strings.IndexByte(p.s[p.i:], ':')
+	if end == -1 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+	encoded := p.s[p.i : p.i+end]
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if !isAlpha(c) && !isDigit(c) && c != '+' && c != '/' && c != '=' {
+			return nil, p.errorf("invalid byte sequence character %q", c)
+		}
+	}
+	p.i += end + 1
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, p.errorf("invalid base64: %v", err)
+	}
+	return decoded, nil
+}
+
+func (p *sfParser) parseBoolean() (bool, error) {
+	p.i++ // Skip "?"
+	if p.eof() {
+		return false, p.errorf("unterminated boolean")
+	}
+	c := p.s[p.i]
+	p.i++
+	switch c {
+	case '1':
+		return true, nil
+	case '0':
+		return false, nil
+	default:
+		return false, p.errorf("invalid boolean %q", c)
+	}
+}
+
+func (p *sfParser) parseDate() (time.Time, error) {
+	p.i++ // Skip "@"
+	if p.eof() || !(isDigit(p.s[p.i]) || p.s[p.i] == '-') {
+		return time.Time{}, p.errorf("invalid date")
+	}
+	num, err := p.parseNumber()
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, ok := num.(int64)
+	if !ok {
+		return time.Time{}, p.errorf("date must be an integer")
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Serialize returns the canonical field value of the Item.
+func (i Item) Serialize() (string, error) {
+	var b strings.Builder
+	if err := serializeItem(&b, i); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Serialize returns the canonical field value of the List.
+func (l List) Serialize() (string, error) {
+	var b strings.Builder
+	for idx, member := range l {
+		if idx > 0 {
+			b.WriteString(", ")
+		}
+		if err := serializeMember(&b, member); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// Serialize returns the canonical field value of the Dictionary.
+func (d Dictionary) Serialize() (string, error) {
+	var b strings.Builder
+	for idx, m := range d {
+		if idx > 0 {
+			b.WriteString(", ")
+		}
+		if err := serializeKey(&b, m.Key); err != nil {
+			return "", err
+		}
+
+		// A true boolean Item is written as a bare key
+		if item, ok := m.Member.(Item); ok {
+			if v, ok := item.Value.(bool); ok && v {
+				if err := serializeParams(&b, item.Params); err != nil {
+					return "", err
+				}
+				continue
+			}
+		}
+
+		b.WriteByte('=')
+		if err := serializeMember(&b, m.Member); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func serializeMember(b *strings.Builder, member any) error {
+	switch m := member.(type) {
+	case Item:
+		return serializeItem(b, m)
+	case InnerList:
+		b.WriteByte('(')
+		for idx, item := range m.Items {
+			if idx > 0 {
+				b.WriteByte(' ')
+			}
+			if err := serializeItem(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(')')
+		return serializeParams(b, m.Params)
+	default:
+		return fmt.Errorf("structured field: invalid member type %T", member)
+	}
+}
+
+func serializeItem(b *strings.Builder, item Item) error {
+	if err := serializeBareItem(b, item.Value); err != nil {
+		return err
+	}
+	return serializeParams(b, item.Params)
+}
+
+func serializeParams(b *strings.Builder, params Params) error {
+	for _, param := range params {
+		b.WriteByte(';')
+		if err := serializeKey(b, param.Key); err != nil {
+			return err
+		}
+		if v, ok := param.Value.(bool); ok && v {
+			continue
+		}
+		b.WriteByte('=')
+		if err := serializeBareItem(b, param.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serializeKey(b *strings.Builder, key string) error {
+	if key == "" || !(isLCAlpha(key[0]) || key[0] == '*') {
+		return fmt.Errorf("structured field: invalid key %q", key)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("structured field: invalid key %q", key)
+		}
+	}
+	b.WriteString(key)
+	return nil
+}
+
+func serializeBareItem(b *strings.Builder, value any) error {
+	switch v := value.(type) {
+	case int:
+		return serializeInteger(b, int64(v))
+	case int64:
+		return serializeInteger(b, v)
+	case float64:
+		return serializeDecimal(b, v)
+	case string:
+		return serializeString(b, v)
+	case Token:
+		return serializeToken(b, v)
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+		return nil
+	case bool:
+		if v {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+		return nil
+	case time.Time:
+		b.WriteByte('@')
+		return serializeInteger(b, v.Unix())
+	default:
+		return fmt.Errorf("structured field: invalid bare item type %T", value)
+	}
+}
+
+func serializeInteger(b *strings.Builder, v int64) error {
+	if v < -999_999_999_999_999 || v > 999_999_999_999_999 {
+		return fmt.Errorf("structured field: integer %d out of range", v)
+	}
+	b.WriteString(strconv.FormatInt(v, 10))
+	return nil
+}
+
+func serializeDecimal(b *strings.Builder, v float64) error {
+	rounded := math.RoundToEven(v*1000) / 1000
+	if math.IsNaN(rounded) || math.Abs(rounded) >= 1e12 {
+		return fmt.Errorf("structured field: decimal %v out of range", v)
+	}
+	s := strconv.FormatFloat(rounded, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	b.WriteString(s)
+	return nil
+}
+
+func serializeString(b *strings.Builder, v string) error {
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("structured field: invalid string character %q", c)
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return nil
+}
+
+func serializeToken(b *strings.Builder, v Token) error {
+	if v == "" || !(v[0] == '*' || isAlpha(v[0])) {
+		return fmt.Errorf("structured field: invalid token %q", v)
+	}
+	for i := 1; i < len(v); i++ {
+		if !isTChar(v[i]) && v[i] != ':' && v[i] != '/' {
+			return fmt.Errorf("structured field: invalid token %q", v)
+		}
+	}
+	b.WriteString(string(v))
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLCAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isAlpha(c byte) bool {
+	return isLCAlpha(c) || (c >= 'A' && c <= 'Z')
+}
+
+func isKeyChar(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// isTChar reports whether c is a token character as defined in RFC 9110 Section 5.6.2.
+func isTChar(c byte) bool {
+	if isAlpha(c) || isDigit(c) {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
@@ -0,0 +1,250 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Vectors taken from the HTTP WG structured-field-tests suite. An empty
+// canonical value means the canonical form equals the raw input.
+var sfVectors = []struct {
+	name      string
+	kind      string
+	raw       string
+	canonical string
+	fail      bool
+}{
+	// examples.json
+	{name: "Foo-Example", kind: "item", raw: `2; foourl="https://foo.example.com/"`, canonical: `2;foourl="https://foo.example.com/"`},
+	{name: "Example-StrListHeader", kind: "list", raw: `"foo", "bar", "It was the best of times."`},
+	{name: "Example-Hdr (list on one line)", kind: "list", raw: `foo, bar`},
+	{name: "Example-StrListListHeader", kind: "list", raw: `("foo" "bar"), ("baz"), ("bat" "one"), ()`},
+	{name: "Example-ListListParam", kind: "list", raw: `("foo"; a=1;b=2);lvl=5, ("bar" "baz");lvl=1`, canonical: `("foo";a=1;b=2);lvl=5, ("bar" "baz");lvl=1`},
+	{name: "Example-ParamListHeader", kind: "list", raw: `abc;a=1;b=2; cde_456, (ghi;jk=4 l);q="9";r=w`, canonical: `abc;a=1;b=2;cde_456, (ghi;jk=4 l);q="9";r=w`},
+	{name: "Example-IntHeader", kind: "item", raw: `1; a; b=?0`, canonical: `1;a;b=?0`},
+	{name: "Example-DictHeader", kind: "dictionary", raw: `en="Applepie", da=:w4ZibGV0w6ZydGU=:`},
+	{name: "Example-DictHeader (boolean values)", kind: "dictionary", raw: `a=?0, b, c; foo=bar`, canonical: `a=?0, b, c;foo=bar`},
+	{name: "Example-DictListHeader", kind: "dictionary", raw: `rating=1.5, feelings=(joy sadness)`},
+	{name: "Example-MixDict", kind: "dictionary", raw: `a=(1 2), b=3, c=4;aa=bb, d=(5 6);valid`},
+	{name: "Example-Hdr (dictionary on one line)", kind: "dictionary", raw: `foo=1, bar=2`},
+
+	// number.json
+	{name: "basic integer", kind: "item", raw: `42`},
+	{name: "zero integer", kind: "item", raw: `0`},
+	{name: "negative zero", kind: "item", raw: `-0`, canonical: `0`},
+	{name: "double negative zero", kind: "item", raw: `--0`, fail: true},
+	{name: "negative integer", kind: "item", raw: `-42`},
+	{name: "leading 0 integer", kind: "item", raw: `042`, canonical: `42`},
+	{name: "comma", kind: "item", raw: `2,3`, fail: true},
+	{name: "negative non-DIGIT first character", kind: "item", raw: `-a23`, fail: true},
+	{name: "sign out of place", kind: "item", raw: `4-2`, fail: true},
+	{name: "whitespace after sign", kind: "item", raw: `- 42`, fail: true},
+	{name: "long integer", kind: "item", raw: `123456789012345`},
+	{name: "long negative integer", kind: "item", raw: `-123456789012345`},
+	{name: "too long integer", kind: "item", raw: `1234567890123456`, fail: true},
+	{name: "simple decimal", kind: "item", raw: `1.23`},
+	{name: "negative decimal", kind: "item", raw: `-1.23`},
+	{name: "decimal, whitespace after decimal", kind: "item", raw: `1. 23`, fail: true},
+	{name: "decimal, whitespace before decimal", kind: "item", raw: `1 .23`, fail: true},
+	{name: "negative decimal, whitespace after sign", kind: "item", raw: `- 1.23`, fail: true},
+	{name: "tricky precision decimal", kind: "item", raw: `123456789012.1`},
+	{name: "double decimal decimal", kind: "item", raw: `1.5.4`, fail: true},
+	{name: "adjacent double decimal decimal", kind: "item", raw: `1..4`, fail: true},
+	{name: "decimal with three fractional digits", kind: "item", raw: `1.123`},
+	{name: "negative decimal with three fractional digits", kind: "item", raw: `-1.123`},
+	{name: "decimal with four fractional digits", kind: "item", raw: `1.1234`, fail: true},
+	{name: "too long integer part", kind: "item", raw: `1234567890123.0`, fail: true},
+	{name: "decimal with trailing zero", kind: "item", raw: `1.50`, canonical: `1.5`},
+	{name: "decimal with trailing dot", kind: "item", raw: `1.`, fail: true},
+
+	// string.json
+	{name: "basic string", kind: "item", raw: `"foo bar"`},
+	{name: "empty string", kind: "item", raw: `""`},
+	{name: "long string", kind: "item", raw: `"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`},
+	{name: "whitespace string", kind: "item", raw: `"   "`},
+	{name: "non-ascii string", kind: "item", raw: "\"füü\"", fail: true},
+	{name: "tab in string", kind: "item", raw: "\"\t\"", fail: true},
+	{name: "newline in string", kind: "item", raw: "\" \n \"", fail: true},
+	{name: "single quoted string", kind: "item", raw: `'foo'`, fail: true},
+	{name: "unbalanced string", kind: "item", raw: `"foo`, fail: true},
+	{name: "string quoting", kind: "item", raw: `"foo \"bar\" \\ baz"`},
+	{name: "bad string quoting", kind: "item", raw: `"foo \,"`, fail: true},
+	{name: "ending string quote", kind: "item", raw: `"foo \"`, fail: true},
+	{name: "abruptly ending string quote", kind: "item", raw: `"foo \`, fail: true},
+
+	// token.json
+	{name: "basic token - item", kind: "item", raw: `a_b-c.d3:f%00/*`},
+	{name: "token with capitals - item", kind: "item", raw: `fooBar`},
+	{name: "token starting with capitals - item", kind: "item", raw: `FooBar`},
+	{name: "token starting with asterisk", kind: "item", raw: `*foo`},
+	{name: "token starting with digit", kind: "list", raw: `1foo`, fail: true},
+
+	// binary.json
+	{name: "basic binary", kind: "item", raw: `:aGVsbG8=:`},
+	{name: "empty binary", kind: "item", raw: `::`},
+	{name: "bad paddding", kind: "item", raw: `:aGVsbG8:`, fail: true},
+	{name: "bad end delimiter", kind: "item", raw: `:aGVsbG8=`, fail: true},
+	{name: "extra whitespace", kind: "item", raw: `:aGVsb G8=:`, fail: true},
+	{name: "all chars in binary", kind: "item", raw: `:/+Ah:`},
+
+	// boolean.json
+	{name: "basic true boolean", kind: "item", raw: `?1`},
+	{name: "basic false boolean", kind: "item", raw: `?0`},
+	{name: "unknown boolean", kind: "item", raw: `?Q`, fail: true},
+	{name: "whitespace boolean", kind: "item", raw: `? 1`, fail: true},
+	{name: "negative zero boolean", kind: "item", raw: `?-0`, fail: true},
+	{name: "T boolean", kind: "item", raw: `?T`, fail: true},
+	{name: "truncated boolean", kind: "item", raw: `?`, fail: true},
+
+	// date.json
+	{name: "date - 1970-01-01 00:00:00", kind: "item", raw: `@0`},
+	{name: "date - 2022-08-04 01:57:13", kind: "item", raw: `@1659578233`},
+	{name: "date - 1917-05-30 22:02:47", kind: "item", raw: `@-1659578233`},
+	{name: "date - decimal", kind: "item", raw: `@1659578233.12`, fail: true},
+	{name: "date - invalid integer", kind: "item", raw: `@1234567890123456`, fail: true},
+
+	// list.json
+	{name: "basic list", kind: "list", raw: `1, 42`},
+	{name: "empty list", kind: "list", raw: ``},
+	{name: "leading SP list", kind: "list", raw: `  42, 43`, canonical: `42, 43`},
+	{name: "single item list", kind: "list", raw: `42`},
+	{name: "no whitespace list", kind: "list", raw: `1,42`, canonical: `1, 42`},
+	{name: "extra whitespace list", kind: "list", raw: `1 , 42`, canonical: `1, 42`},
+	{name: "tab separated list", kind: "list", raw: "1\t,\t42", canonical: `1, 42`},
+	{name: "trailing comma list", kind: "list", raw: `1, 42,`, fail: true},
+	{name: "empty item list", kind: "list", raw: `1,,42`, fail: true},
+
+	// listlist.json
+	{name: "basic list of lists", kind: "list", raw: `(1 2), (42 43)`},
+	{name: "single item list of lists", kind: "list", raw: `(42)`},
+	{name: "empty item list of lists", kind: "list", raw: `()`},
+	{name: "empty middle item list of lists", kind: "list", raw: `(1),(),(42)`, canonical: `(1), (), (42)`},
+	{name: "extra whitespace list of lists", kind: "list", raw: `( 1  42 )`, canonical: `(1 42)`},
+	{name: "wrong whitespace list of lists", kind: "list", raw: "(1\t 42)", fail: true},
+	{name: "no trailing parenthesis list of lists", kind: "list", raw: `(1 42`, fail: true},
+	{name: "no inner list separator", kind: "list", raw: `(1)(42)`, fail: true},
+
+	// dictionary.json
+	{name: "basic dictionary", kind: "dictionary", raw: `en="Applepie", da=:w4ZibGV0w6ZydGUK:`},
+	{name: "empty dictionary", kind: "dictionary", raw: ``},
+	{name: "single item dictionary", kind: "dictionary", raw: `a=1`},
+	{name: "list item dictionary", kind: "dictionary", raw: `a=(1 2)`},
+	{name: "no whitespace dictionary", kind: "dictionary", raw: `a=1,b=2`, canonical: `a=1, b=2`},
+	{name: "extra whitespace dictionary", kind: "dictionary", raw: `a=1 ,  b=2`, canonical: `a=1, b=2`},
+	{name: "space before = dictionary", kind: "dictionary", raw: `a =1, b=2`, fail: true},
+	{name: "space after = dictionary", kind: "dictionary", raw: `a=1, b= 2`, fail: true},
+	{name: "duplicate key dictionary", kind: "dictionary", raw: `a=1,b=2,a=3`, canonical: `a=3, b=2`},
+	{name: "numeric key dictionary", kind: "dictionary", raw: `a=1,1b=2,a=1`, fail: true},
+	{name: "uppercase key dictionary", kind: "dictionary", raw: `a=1,B=2,a=1`, fail: true},
+	{name: "bad key dictionary", kind: "dictionary", raw: `a=1,b!=2,a=1`, fail: true},
+	{name: "missing value dictionary", kind: "dictionary", raw: `a=1, b, c=3`},
+	{name: "all missing value dictionary", kind: "dictionary", raw: `a, b, c`},
+	{name: "start missing value dictionary", kind: "dictionary", raw: `a, b=2`},
+	{name: "missing value with params dictionary", kind: "dictionary", raw: `a=1, b;foo=9, c=3`},
+	{name: "trailing comma dictionary", kind: "dictionary", raw: `a=1, b=2,`, fail: true},
+	{name: "empty item dictionary", kind: "dictionary", raw: `a=1,,b=2,`, fail: true},
+
+	// param-list.json / param-dict.json
+	{name: "basic parameterised list", kind: "list", raw: `abc_123;a=1;b=2; cdef_456, ghi;q=9;r="+w"`, canonical: `abc_123;a=1;b=2;cdef_456, ghi;q=9;r="+w"`},
+	{name: "single item parameterised list", kind: "list", raw: `text/html;q=1.0`},
+	{name: "missing parameter value parameterised list", kind: "list", raw: `text/html;a;q=1.0`},
+	{name: "missing terminal parameter value parameterised list", kind: "list", raw: `text/html;q=1.0;a`},
+	{name: "whitespace before = parameterised list", kind: "list", raw: `text/html, text/plain;q =0.5`, fail: true},
+	{name: "whitespace before ; parameterised list", kind: "list", raw: `text/html, text/plain ;q=0.5`, fail: true},
+	{name: "duplicate parameter", kind: "item", raw: `1;a=1;b=2;a=3`, canonical: `1;a=3;b=2`},
+	{name: "basic parameterised dict", kind: "dictionary", raw: `abc=123;a=1;b=2, def=456, ghi=789;q=9;r="+w"`},
+}
+
+func TestStructuredFieldVectors(t *testing.T) {
+	for _, v := range sfVectors {
+		t.Run(v.name, func(t *testing.T) {
+			var (
+				serialized string
+				err        error
+			)
+			switch v.kind {
+			case "item":
+				var item Item
+				item, err = ParseItem(v.raw)
+				if err == nil {
+					serialized, err = item.Serialize()
+				}
+			case "list":
+				var list List
+				list, err = ParseList(v.raw)
+				if err == nil {
+					serialized, err = list.Serialize()
+				}
+			case "dictionary":
+				var dict Dictionary
+				dict, err = ParseDictionary(v.raw)
+				if err == nil {
+					serialized, err = dict.Serialize()
+				}
+			}
+
+			if v.fail {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			expected := v.canonical
+			if expected == "" {
+				expected = v.raw
+			}
+			assert.Equal(t, expected, serialized)
+		})
+	}
+}
+
+func TestStructuredFieldTypes(t *testing.T) {
+	item, err := ParseItem(`abc;q=0.5;d=@1659578233;b=:aGVsbG8=:;s="x";t=?0`)
+	require.NoError(t, err)
+	assert.Equal(t, Token("abc"), item.Value)
+
+	q, ok := item.Params.Get("q")
+	require.True(t, ok)
+	assert.Equal(t, 0.5, q)
+
+	d, _ := item.Params.Get("d")
+	assert.Equal(t, time.Unix(1659578233, 0).UTC(), d)
+
+	b, _ := item.Params.Get("b")
+	assert.Equal(t, []byte("hello"), b)
+
+	s, _ := item.Params.Get("s")
+	assert.Equal(t, "x", s)
+
+	f, _ := item.Params.Get("t")
+	assert.Equal(t, false, f)
+
+	dict, err := ParseDictionary(`u=3, i`)
+	require.NoError(t, err)
+	u, ok := dict.Get("u")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), u.(Item).Value)
+	i, _ := dict.Get("i")
+	assert.Equal(t, true, i.(Item).Value)
+}
+
+func TestStructuredFieldSerializeErrors(t *testing.T) {
+	_, err := Item{Value: int64(1_000_000_000_000_000)}.Serialize()
+	require.Error(t, err)
+
+	_, err = Item{Value: "café"}.Serialize()
+	require.Error(t, err)
+
+	_, err = Item{Value: Token("1abc")}.Serialize()
+	require.Error(t, err)
+
+	_, err = Item{Value: 1, Params: Params{{Key: "A", Value: true}}}.Serialize()
+	require.Error(t, err)
+
+	s, err := Item{Value: 1.0005}.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", s)
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests served.", "method", "status")
+	active := r.NewGauge("active", "Active things,\nwith a line break.")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	r.NewCounter("unused_total", "Never updated.")
+
+	requests.Inc("POST", "201")
+	requests.Add(2, "GET", "200")
+	active.Inc()
+	active.Inc()
+	active.Dec()
+	latency.Observe(0.05, `/a"b`)
+	latency.Observe(0.1, `/a"b`)
+	latency.Observe(5, `/a"b`)
+
+	// Test: Exposition format
+	buf := new(strings.Builder)
+	require.NoError(t, r.WriteText(buf))
+	assert.Equal(t, `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="201"} 1
+# HELP active Active things,\nwith a line break.
+# TYPE active gauge
+active 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a\"b",le="0.1"} 2
+latency_seconds_bucket{route="/a\"b",le="1"} 2
+latency_seconds_bucket{route="/a\"b",le="+Inf"} 3
+latency_seconds_sum{route="/a\"b"} 5.15
+latency_seconds_count{route="/a\"b"} 3
+# HELP unused_total Never updated.
+# TYPE unused_total counter
+unused_total 0
+`, buf.String())
+
+	// Test: Misuse panics
+	assert.Panics(t, func() { r.NewGauge("active", "Again.") })
+	assert.Panics(t, func() { requests.Inc("GET") })
+	assert.Panics(t, func() { requests.Add(-1, "GET", "200") })
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c", "Counter.", "worker")
+	g := r.NewGauge("g", "Gauge.")
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				c.Inc("w")
+				g.Add(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	buf := new(strings.Builder)
+	require.NoError(t, r.WriteText(buf))
+	assert.Contains(t, buf.String(), "c{worker=\"w\"} 8000\n")
+	assert.Contains(t, buf.String(), "g 4000\n")
+}
@@ -0,0 +1,286 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/chunked"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+const (
+	bufferSize = 8
+)
+
+const (
+	INITIALIZED = iota
+	DONE
+	PARSING_HEADERS
+	PARSING_BODY
+	PARSING_CHUNKED
+	PARSING_BODY_UNTIL_CLOSE
+)
+
+// maxInterimResponses caps the 1xx responses accepted before the final one.
+const maxInterimResponses = 10
+
+type Response struct {
+	StatusLine StatusLine
+	State      int
+	Headers    headers.Headers
+	Body       []byte
+
+	// SetCookies holds the raw Set-Cookie values, they're kept apart because
+	// they can't be combined into one field (RFC 6265 Section 3)
+	SetCookies []string
+
+	// Trailers sent after a chunked body, fields forbidden in trailers are dropped
+	Trailers headers.Headers
+
+	// Interim holds the 1xx responses received before the final one, e.g. 103 Early Hints
+	Interim []Interim
+
+	// method of the request the response answers, HEAD responses have no body
+	method string
+
+	// chunked decodes a chunked body
+	chunked chunked.Decoder
+}
+
+type StatusLine struct {
+	HttpVersion  string
+	StatusCode   response.StatusCode
+	ReasonPhrase string
+}
+
+// Interim is an informational (1xx) response.
+type Interim struct {
+	StatusLine StatusLine
+	Headers    headers.Headers
+}
+
+// ResponseFromReader parses the response to a request with the given method.
+// A 101 Switching Protocols response is done after its headers, whatever
+// follows belongs to the new protocol.
+func ResponseFromReader(reader io.Reader, method string) (*Response, error) {
+	buf := make([]byte, 0, bufferSize)
+	response := &Response{
+		State:  INITIALIZED,
+		method: method,
+	}
+
+	for response.State != DONE {
+		// Temporary buffer for reading
+		tmpBuf := make([]byte, bufferSize)
+		n, readErr := reader.Read(tmpBuf)
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+
+		// Bytes returned along with io.EOF are parsed before stopping
+		buf = append(buf, tmpBuf[:n]...)
+
+		// Try to parse
+		parsed, err := response.parse(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed > 0 {
+			buf = buf[parsed:]
+		}
+
+		if readErr == io.EOF {
+			// The connection closing is what ends a body without framing
+			if response.State == PARSING_BODY_UNTIL_CLOSE {
+				response.State = DONE
+			}
+			break
+		}
+	}
+
+	if response.State != DONE {
+		return nil, fmt.Errorf("incomplete response")
+	}
+
+	return response, nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+
+	for r.State != DONE {
+		prevState := r.State
+		n, err := r.parseSingle(data[totalBytesParsed:])
+		if err != nil {
+			return totalBytesParsed, err
+		}
+		totalBytesParsed += n
+
+		if n == 0 && r.State == prevState {
+			break // need more data
+		}
+	}
+
+	return totalBytesParsed, nil
+}
+
+func (r *Response) parseSingle(data []byte) (int, error) {
+	switch r.State {
+	case INITIALIZED:
+		n, err := r.parseStatusLine(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if n > 0 {
+			r.State = PARSING_HEADERS
+		}
+
+		return n, nil
+
+	case PARSING_HEADERS:
+		// Initialize headers if not already
+		if r.Headers == nil {
+			r.Headers = headers.NewHeaders()
+		}
+
+		// Set-Cookie lines are collected as they are instead of being combined
+		index := bytes.Index(data, []byte("\r\n"))
+		if index == -1 {
+			return 0, nil // need more data
+		}
+		if name, value, ok := bytes.Cut(data[:index], []byte(":")); ok && strings.EqualFold(string(bytes.TrimSpace(name)), "Set-Cookie") {
+			r.SetCookies = append(r.SetCookies, string(bytes.TrimSpace(value)))
+			return index + 2, nil
+		}
+
+		// Parse headers
+		n, done, err := r.Headers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+
+		// Move to next state if headers are done
+		if done {
+			r.State = PARSING_BODY
+		}
+
+		// Return if no data was parsed
+		return n, nil
+
+	case PARSING_BODY:
+		status := r.StatusLine.StatusCode
+
+		// Interim responses are followed by another response
+		if status >= 100 && status < 200 && status != response.SwitchingProtocols {
+			if len(r.Interim) >= maxInterimResponses {
+				return 0, fmt.Errorf("error: too many interim responses")
+			}
+			r.Interim = append(r.Interim, Interim{StatusLine: r.StatusLine, Headers: r.Headers})
+			r.StatusLine = StatusLine{}
+			r.Headers = nil
+			r.SetCookies = nil
+			r.State = INITIALIZED
+			return 0, nil
+		}
+
+		// HEAD responses and these statuses never have a body (RFC 9112 Section 6.3)
+		if r.method == "HEAD" || status < 200 || status == response.NoContent || status == response.NotModified {
+			r.State = DONE
+			return 0, nil
+		}
+
+		// Transfer-Encoding takes precedence over Content-Length
+		if te := r.Headers.Get("Transfer-Encoding"); te != "" {
+			if !strings.EqualFold(strings.TrimSpace(te[strings.LastIndex(te, ",")+1:]), "chunked") {
+				// Only chunked is self-delimiting, anything else runs until close
+				r.State = PARSING_BODY_UNTIL_CLOSE
+				return 0, nil
+			}
+			r.State = PARSING_CHUNKED
+			return 0, nil
+		}
+
+		// Without Content-Length the body runs until the connection closes
+		if r.Headers.Get("Content-Length") == "" {
+			r.State = PARSING_BODY_UNTIL_CLOSE
+			return 0, nil
+		}
+
+		contentLengthInt, err := strconv.ParseInt(r.Headers.Get("Content-Length"), 10, 64)
+		if err != nil || contentLengthInt < 0 {
+			return 0, fmt.Errorf("error: invalid Content-Length: %q", r.Headers.Get("Content-Length"))
+		}
+
+		// Take only what belongs to the body, the rest is the next response
+		n := min(int64(len(data)), contentLengthInt-int64(len(r.Body)))
+		r.Body = append(r.Body, data[:n]...)
+
+		// If the length of the body is equal to the Content-Length header, move to the done state
+		if int64(len(r.Body)) == contentLengthInt {
+			r.State = DONE
+		}
+
+		return int(n), nil
+
+	case PARSING_BODY_UNTIL_CLOSE:
+		r.Body = append(r.Body, data...)
+		return len(data), nil
+
+	case PARSING_CHUNKED:
+		n, chunk, err := r.chunked.Decode(data)
+		if err != nil {
+			return 0, err
+		}
+		r.Body = append(r.Body, chunk...)
+
+		if r.chunked.Done() {
+			r.Trailers = r.chunked.Trailers
+			r.State = DONE
+		}
+		return n, nil
+
+	default:
+		return 0, fmt.Errorf("error: unknown state")
+	}
+}
+
+func (r *Response) parseStatusLine(data []byte) (int, error) {
+	index := bytes.Index(data, []byte("\r\n"))
+	if index == -1 {
+		return 0, nil // need more data
+	}
+
+	statusLine, err := ParseStatusLine(string(data[:index]))
+	if err != nil {
+		return 0, err
+	}
+	r.StatusLine = statusLine
+
+	return index + 2, nil // Account for \r\n
+}
+
+// ParseStatusLine parses e.g. "HTTP/1.1 404 Not Found", the reason phrase may be empty.
+func ParseStatusLine(line string) (StatusLine, error) {
+	version, rest, ok := strings.Cut(line, " ")
+	if !ok || (version != "HTTP/1.1" && version != "HTTP/1.0") {
+		return StatusLine{}, fmt.Errorf("error malformed status line: %s", line)
+	}
+
+	codeStr, reason, _ := strings.Cut(rest, " ")
+	code, err := strconv.Atoi(codeStr)
+	if err != nil || len(codeStr) != 3 || code < 100 {
+		return StatusLine{}, fmt.Errorf("error malformed status code: %s", codeStr)
+	}
+
+	return StatusLine{
+		HttpVersion:  strings.TrimPrefix(version, "HTTP/"),
+		StatusCode:   response.StatusCode(code),
+		ReasonPhrase: reason,
+	}, nil
+}
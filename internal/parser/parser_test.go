@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+// Read reads up to len(p) or numBytesPerRead bytes from the string per call
+// its useful for simulating reading a variable number of bytes per chunk from a network connection
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+	return n, nil
+}
+
+func TestParseStatusLine(t *testing.T) {
+	// Test: Good status line
+	r, err := ResponseFromReader(&chunkReader{
+		data:            "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	}, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.StatusLine.HttpVersion)
+	assert.Equal(t, response.NotFound, r.StatusLine.StatusCode)
+	assert.Equal(t, "Not Found", r.StatusLine.ReasonPhrase)
+
+	// Test: Empty reason phrase
+	r, err = ResponseFromReader(&chunkReader{data: "HTTP/1.0 200 \r\nContent-Length: 0\r\n\r\n", numBytesPerRead: 5}, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.OK, r.StatusLine.StatusCode)
+	assert.Equal(t, "", r.StatusLine.ReasonPhrase)
+
+	// Test: Malformed status lines
+	for _, line := range []string{"HTTP/2 200 OK", "HTTP/1.1 20 OK", "HTTP/1.1 abc OK", "200 OK"} {
+		_, err = ResponseFromReader(&chunkReader{data: line + "\r\n\r\n", numBytesPerRead: 4}, "GET")
+		require.Error(t, err, line)
+	}
+}
+
+func TestParseResponseBody(t *testing.T) {
+	// Test: Content-Length body, cookies kept apart
+	r, err := ResponseFromReader(&chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Set-Cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n" +
+			"Set-Cookie: b=2\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "b=2"}, r.SetCookies)
+
+	// Test: Chunked body with trailers
+	r, err = ResponseFromReader(&chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5;ext=1\r\nhello\r\n" +
+			"6\r\n world\r\n" +
+			"0\r\n" +
+			"X-Sum: abc\r\n" +
+			"Host: evil\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers.Get("X-Sum"))
+	assert.Empty(t, r.Trailers.Get("Host"))
+
+	// Test: Body delimited by connection close
+	r, err = ResponseFromReader(&chunkReader{data: "HTTP/1.1 200 OK\r\n\r\nuntil the end", numBytesPerRead: 2}, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", string(r.Body))
+
+	// Test: Data returned together with io.EOF is parsed
+	r, err = ResponseFromReader(iotest.DataErrReader(&chunkReader{data: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", numBytesPerRead: 3}), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	r, err = ResponseFromReader(iotest.DataErrReader(&chunkReader{data: "HTTP/1.1 200 OK\r\n\r\nuntil the end", numBytesPerRead: 3}), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", string(r.Body))
+
+	// Test: Body shorter than Content-Length
+	_, err = ResponseFromReader(&chunkReader{data: "HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\nshort", numBytesPerRead: 3}, "GET")
+	require.Error(t, err)
+
+	// Test: HEAD, 204 and 304 have no body
+	r, err = ResponseFromReader(&chunkReader{data: "HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\n", numBytesPerRead: 3}, "HEAD")
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+	for _, status := range []string{"204 No Content", "304 Not Modified"} {
+		r, err = ResponseFromReader(&chunkReader{data: "HTTP/1.1 " + status + "\r\nContent-Length: 42\r\n\r\n", numBytesPerRead: 3}, "GET")
+		require.NoError(t, err)
+		assert.Empty(t, r.Body)
+	}
+}
+
+func TestParseInterimResponses(t *testing.T) {
+	// Test: 100 Continue and 103 Early Hints before the final response
+	r, err := ResponseFromReader(&chunkReader{
+		data: "HTTP/1.1 100 Continue\r\n\r\n" +
+			"HTTP/1.1 103 Early Hints\r\n" +
+			"Link: </style.css>; rel=preload; as=style\r\n" +
+			"\r\n" +
+			"HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 2\r\n" +
+			"\r\n" +
+			"ok",
+		numBytesPerRead: 5,
+	}, "GET")
+	require.NoError(t, err)
+	require.Len(t, r.Interim, 2)
+	assert.Equal(t, response.Continue, r.Interim[0].StatusLine.StatusCode)
+	assert.Equal(t, response.EarlyHints, r.Interim[1].StatusLine.StatusCode)
+	assert.Equal(t, "</style.css>; rel=preload; as=style", r.Interim[1].Headers.Get("Link"))
+	assert.Equal(t, response.OK, r.StatusLine.StatusCode)
+	assert.Empty(t, r.Headers.Get("Link"))
+	assert.Equal(t, "ok", string(r.Body))
+
+	// Test: 101 Switching Protocols ends the response
+	r, err = ResponseFromReader(&chunkReader{
+		data:            "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n",
+		numBytesPerRead: 7,
+	}, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.SwitchingProtocols, r.StatusLine.StatusCode)
+	assert.Empty(t, r.Interim)
+}
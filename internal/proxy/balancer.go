@@ -0,0 +1,374 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/client"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastConnections
+	Weighted
+	ConsistentHash
+)
+
+const (
+	defaultMaxFailures   = 3
+	defaultEjectDuration = 30 * time.Second
+	defaultCheckInterval = 10 * time.Second
+	defaultCheckTimeout  = 2 * time.Second
+	// Points per unit of weight on the consistent hash ring
+	virtualNodes = 100
+)
+
+// idempotentMethods can be retried on another backend (RFC 9110 Section 9.2.2).
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+type Upstream struct {
+	URL string
+	// Weight is used by the Weighted, LeastConnections and ConsistentHash strategies, defaults to 1
+	Weight int
+}
+
+type HealthCheck struct {
+	// Path is requested with GET on every backend, checks are disabled if empty
+	Path string
+	// Interval between checks, defaults to 10s
+	Interval time.Duration
+	// Timeout for a single check, defaults to 2s
+	Timeout time.Duration
+}
+
+type PoolOptions struct {
+	Options
+	Strategy Strategy
+	// HashHeader or HashCookie selects the key for ConsistentHash,
+	// requests without it are balanced round-robin
+	HashHeader  string
+	HashCookie  string
+	HealthCheck HealthCheck
+	// MaxFailures consecutive failures eject a backend for EjectDuration, defaults to 3 and 30s
+	MaxFailures   int
+	EjectDuration time.Duration
+	// Retries is how many other backends an idempotent request is retried on after a connection failure
+	Retries int
+}
+
+// Backend is a single upstream in a Pool.
+type Backend struct {
+	URL    *url.URL
+	Weight int
+
+	proxy        *ReverseProxy
+	healthy      atomic.Bool
+	active       atomic.Int64
+	failures     atomic.Int64
+	ejectedUntil atomic.Int64
+	// current is the smooth weighted round-robin state, guarded by Pool.mu
+	current int
+}
+
+// Available reports whether the backend passed its last health check and isn't ejected.
+func (b *Backend) Available() bool {
+	return b.healthy.Load() && time.Now().UnixNano() >= b.ejectedUntil.Load()
+}
+
+// ActiveRequests returns the number of requests currently proxied to the backend.
+func (b *Backend) ActiveRequests() int64 {
+	return b.active.Load()
+}
+
+type ringPoint struct {
+	hash    uint32
+	backend *Backend
+}
+
+// Pool load balances requests across several upstream backends.
+type Pool struct {
+	Backends []*Backend
+
+	opts    PoolOptions
+	next    atomic.Uint64
+	mu      sync.Mutex
+	ring    []ringPoint
+	checker *client.Client
+	done    chan struct{}
+	closed  sync.Once
+}
+
+// NewPool creates a Pool and starts its health checks if configured.
+func NewPool(upstreams []Upstream, opts PoolOptions) (*Pool, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("error: pool needs at least one upstream")
+	}
+	if opts.MaxFailures == 0 {
+		opts.MaxFailures = defaultMaxFailures
+	}
+	if opts.EjectDuration == 0 {
+		opts.EjectDuration = defaultEjectDuration
+	}
+	if opts.HealthCheck.Interval == 0 {
+		opts.HealthCheck.Interval = defaultCheckInterval
+	}
+	if opts.HealthCheck.Timeout == 0 {
+		opts.HealthCheck.Timeout = defaultCheckTimeout
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Transport == nil {
+		// All backends share one transport and its idle connections
+		opts.Transport = &client.PooledTransport{Transport: client.Transport{ResponseHeaderTimeout: opts.Timeout}}
+	}
+
+	p := &Pool{
+		opts:    opts,
+		checker: &client.Client{Transport: opts.Transport, Timeout: opts.HealthCheck.Timeout},
+		done:    make(chan struct{}),
+	}
+
+	for _, upstream := range upstreams {
+		proxy, err := New(upstream.URL, opts.Options)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := upstream.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		b := &Backend{URL: proxy.target, Weight: weight, proxy: proxy}
+		b.healthy.Store(true)
+		p.Backends = append(p.Backends, b)
+
+		for i := range weight * virtualNodes {
+			key := b.URL.String() + "#" + strconv.Itoa(i)
+			p.ring = append(p.ring, ringPoint{hash: crc32.ChecksumIEEE([]byte(key)), backend: b})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+
+	if opts.HealthCheck.Path != "" {
+		go p.checkLoop()
+	}
+
+	return p, nil
+}
+
+// Close stops the health checks.
+func (p *Pool) Close() {
+	p.closed.Do(func() { close(p.done) })
+}
+
+// Handle proxies req to a backend picked by the pool's strategy, it can be used as a server.HandlerFunc.
+func (p *Pool) Handle(w *response.Writer, req *request.Request) error {
+	tried := make(map[*Backend]bool)
+	attempts := 1
+	if idempotentMethods[req.RequestLine.Method] {
+		attempts += p.opts.Retries
+	}
+
+	var lastErr error
+	for range attempts {
+		b := p.pick(req, tried)
+		if b == nil {
+			break
+		}
+		tried[b] = true
+
+		outReq, err := b.proxy.outgoingRequest(req)
+		if err != nil {
+			return requestError(err)
+		}
+
+		b.active.Add(1)
+		resp, err := p.opts.Transport.RoundTrip(outReq)
+		if err != nil {
+			b.active.Add(-1)
+			if req.Context().Err() != nil {
+				// The client is gone or the request timed out, that's not the backend's fault
+				log.Printf("error: request to %s abandoned: %v", b.URL.Host, context.Cause(req.Context()))
+				return upstreamError(err)
+			}
+			log.Printf("error: upstream request to %s failed: %v", b.URL.Host, err)
+			p.recordFailure(b)
+			lastErr = err
+			continue
+		}
+
+		switch resp.StatusCode {
+		case response.BadGateway, response.ServiceUnavailable, response.GatewayTimeout:
+			p.recordFailure(b)
+		default:
+			b.failures.Store(0)
+		}
+
+		err = b.proxy.serveResponse(w, req, resp)
+		resp.Body.Close()
+		b.active.Add(-1)
+		return err
+	}
+
+	if lastErr != nil {
+		return upstreamError(lastErr)
+	}
+	return &server.HandleError{StatusCode: response.ServiceUnavailable, Err: errors.New("error: no upstream backend available")}
+}
+
+// recordFailure counts a consecutive failure and ejects the backend once it hits MaxFailures.
+// The count isn't reset on ejection, so a single failure right after it expires ejects it again.
+func (p *Pool) recordFailure(b *Backend) {
+	if b.failures.Add(1) >= int64(p.opts.MaxFailures) {
+		b.ejectedUntil.Store(time.Now().Add(p.opts.EjectDuration).UnixNano())
+		log.Printf("Ejected upstream %s for %s", b.URL.Host, p.opts.EjectDuration)
+	}
+}
+
+// pick returns an available backend that hasn't been tried yet, or nil.
+func (p *Pool) pick(req *request.Request, tried map[*Backend]bool) *Backend {
+	usable := func(b *Backend) bool {
+		return !tried[b] && b.Available()
+	}
+
+	switch p.opts.Strategy {
+	case LeastConnections:
+		var best *Backend
+		offset := int(p.next.Add(1))
+		for i := range p.Backends {
+			b := p.Backends[(offset+i)%len(p.Backends)]
+			if !usable(b) {
+				continue
+			}
+			// Compare active/weight without dividing
+			if best == nil || b.active.Load()*int64(best.Weight) < best.active.Load()*int64(b.Weight) {
+				best = b
+			}
+		}
+		return best
+
+	case Weighted:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// Smooth weighted round-robin, spreads heavier backends out instead of bursting
+		var best *Backend
+		total := 0
+		for _, b := range p.Backends {
+			if !usable(b) {
+				continue
+			}
+			b.current += b.Weight
+			total += b.Weight
+			if best == nil || b.current > best.current {
+				best = b
+			}
+		}
+		if best != nil {
+			best.current -= total
+		}
+		return best
+
+	case ConsistentHash:
+		if key := p.hashKey(req); key != "" {
+			hash := crc32.ChecksumIEEE([]byte(key))
+			start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= hash })
+			// Walk the ring clockwise so keys only move when their backend goes away
+			for i := range p.ring {
+				b := p.ring[(start+i)%len(p.ring)].backend
+				if usable(b) {
+					return b
+				}
+			}
+			return nil
+		}
+	}
+
+	offset := int(p.next.Add(1) - 1)
+	for i := range p.Backends {
+		b := p.Backends[(offset+i)%len(p.Backends)]
+		if usable(b) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *Pool) hashKey(req *request.Request) string {
+	if p.opts.HashHeader != "" {
+		if value := req.Headers.Get(p.opts.HashHeader); value != "" {
+			return value
+		}
+	}
+	if p.opts.HashCookie != "" {
+		if c, err := req.Cookie(p.opts.HashCookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func (p *Pool) checkLoop() {
+	ticker := time.NewTicker(p.opts.HealthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.checkAll()
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Pool) checkAll() {
+	var wg sync.WaitGroup
+	for _, b := range p.Backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			healthy := p.check(b)
+			if b.healthy.Swap(healthy) != healthy {
+				log.Printf("Upstream %s healthy: %t", b.URL.Host, healthy)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// check requests the health check path, any 2xx or 3xx status counts as healthy.
+func (p *Pool) check(b *Backend) bool {
+	u := *b.URL
+	u.Path = singleJoiningSlash(b.URL.Path, p.opts.HealthCheck.Path)
+	u.RawQuery = ""
+
+	resp, err := p.checker.Get(context.Background(), u.String())
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
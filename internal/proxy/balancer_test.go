@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackend(t *testing.T, name string, healthy *atomic.Bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && healthy != nil && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func served(resp string) string {
+	_, body, _ := strings.Cut(resp, "\r\n\r\n")
+	return body
+}
+
+func TestPoolStrategies(t *testing.T) {
+	a := newBackend(t, "a", nil)
+	b := newBackend(t, "b", nil)
+	get := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	// Test: Round-robin alternates
+	pool, err := NewPool([]Upstream{{URL: a.URL}, {URL: b.URL}}, PoolOptions{})
+	require.NoError(t, err)
+	defer pool.Close()
+	assert.Equal(t, "a", served(proxyRequest(t, pool.Handle, get)))
+	assert.Equal(t, "b", served(proxyRequest(t, pool.Handle, get)))
+	assert.Equal(t, "a", served(proxyRequest(t, pool.Handle, get)))
+
+	// Test: Smooth weighted round-robin
+	pool, err = NewPool([]Upstream{{URL: a.URL, Weight: 2}, {URL: b.URL}}, PoolOptions{Strategy: Weighted})
+	require.NoError(t, err)
+	defer pool.Close()
+	var order string
+	for range 6 {
+		order += served(proxyRequest(t, pool.Handle, get))
+	}
+	assert.Equal(t, "abaaba", order)
+
+	// Test: Least connections prefers the idle backend
+	pool, err = NewPool([]Upstream{{URL: a.URL}, {URL: b.URL}}, PoolOptions{Strategy: LeastConnections})
+	require.NoError(t, err)
+	defer pool.Close()
+	pool.Backends[0].active.Add(1)
+	for range 3 {
+		assert.Equal(t, "b", served(proxyRequest(t, pool.Handle, get)))
+	}
+
+	// Test: Consistent hash sticks to one backend per key
+	pool, err = NewPool([]Upstream{{URL: a.URL}, {URL: b.URL}}, PoolOptions{Strategy: ConsistentHash, HashCookie: "user"})
+	require.NoError(t, err)
+	defer pool.Close()
+	for _, user := range []string{"alice", "bob", "carol"} {
+		withCookie := "GET / HTTP/1.1\r\nHost: example.com\r\nCookie: user=" + user + "\r\n\r\n"
+		first := served(proxyRequest(t, pool.Handle, withCookie))
+		for range 3 {
+			assert.Equal(t, first, served(proxyRequest(t, pool.Handle, withCookie)))
+		}
+	}
+}
+
+func TestPoolFailures(t *testing.T) {
+	a := newBackend(t, "a", nil)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	get := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	post := "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n"
+
+	// Test: Idempotent requests are retried on another backend, others aren't
+	pool, err := NewPool([]Upstream{{URL: down.URL}, {URL: a.URL}}, PoolOptions{Retries: 1, MaxFailures: 2})
+	require.NoError(t, err)
+	defer pool.Close()
+	assert.Equal(t, "a", served(proxyRequest(t, pool.Handle, get)))
+	assert.True(t, strings.HasPrefix(proxyRequest(t, pool.Handle, post), "HTTP/1.1 502 Bad Gateway\r\n"))
+
+	// Test: Consecutive failures eject the backend
+	assert.False(t, pool.Backends[0].Available())
+	for range 3 {
+		assert.Equal(t, "a", served(proxyRequest(t, pool.Handle, post)))
+	}
+
+	// Test: Active health checks take backends out and back in
+	var healthy atomic.Bool
+	healthy.Store(true)
+	b := newBackend(t, "b", &healthy)
+	pool, err = NewPool([]Upstream{{URL: b.URL}}, PoolOptions{
+		HealthCheck: HealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	defer pool.Close()
+
+	healthy.Store(false)
+	assert.Eventually(t, func() bool { return !pool.Backends[0].Available() }, time.Second, 5*time.Millisecond)
+	assert.True(t, strings.HasPrefix(proxyRequest(t, pool.Handle, get), "HTTP/1.1 503 Service Unavailable\r\n"))
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return pool.Backends[0].Available() }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "b", served(proxyRequest(t, pool.Handle, get)))
+}
@@ -0,0 +1,337 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/client"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+const defaultDialTimeout = 10 * time.Second
+
+// errDeniedAddress is returned when a destination only resolves to addresses the proxy mustn't reach.
+var errDeniedAddress = errors.New("error: destination address denied")
+
+type ForwardOptions struct {
+	// AllowedPorts are the destination ports clients may reach, defaults to 80 and 443
+	AllowedPorts []int
+	// AllowedHosts restricts destinations to these hosts, "*.example.com" matches
+	// any subdomain. All hosts are allowed if empty
+	AllowedHosts []string
+	// AllowPrivateAddresses allows destinations that resolve to loopback, private
+	// or link-local addresses. They're denied by default so clients can't reach
+	// internal services through the proxy, e.g. cloud metadata on 169.254.169.254
+	AllowPrivateAddresses bool
+	// Username and Password enable Proxy-Authorization Basic auth when set.
+	// Either credentials or AllowedHosts are required, an open proxy is refused
+	Username string
+	Password string
+	// Realm sent in Proxy-Authenticate, defaults to "proxy"
+	Realm string
+	// DialTimeout limits connecting to CONNECT targets, defaults to 10s
+	DialTimeout time.Duration
+	// Timeout limits how long to wait for upstream response headers, defaults to 30s
+	Timeout time.Duration
+	// Transport sends plain HTTP requests, defaults to a client.PooledTransport
+	Transport client.RoundTripper
+}
+
+// ForwardProxy is an explicit HTTP proxy, clients send it absolute-form
+// requests (GET http://host/path) and CONNECT requests for tunnels.
+type ForwardProxy struct {
+	opts  ForwardOptions
+	relay *ReverseProxy
+}
+
+// NewForward creates a ForwardProxy, opts must set credentials or AllowedHosts.
+func NewForward(opts ForwardOptions) (*ForwardProxy, error) {
+	if opts.Username == "" && opts.Password == "" && len(opts.AllowedHosts) == 0 {
+		return nil, fmt.Errorf("error: forward proxy needs credentials or AllowedHosts")
+	}
+	if len(opts.AllowedPorts) == 0 {
+		opts.AllowedPorts = []int{80, 443}
+	}
+	if opts.Realm == "" {
+		opts.Realm = "proxy"
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = defaultDialTimeout
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Transport == nil {
+		opts.Transport = &client.PooledTransport{Transport: client.Transport{ResponseHeaderTimeout: opts.Timeout}}
+	}
+
+	return &ForwardProxy{
+		opts: opts,
+		// Responses are relayed like a reverse proxy's, minus the Location rewriting
+		relay: &ReverseProxy{opts: Options{Transport: opts.Transport, Timeout: opts.Timeout}},
+	}, nil
+}
+
+// IsProxyRequest reports whether req is addressed to a forward proxy.
+func IsProxyRequest(req *request.Request) bool {
+	target := req.RequestLine.RequestTarget
+	return req.RequestLine.Method == "CONNECT" || strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// Handle serves a proxy request, it can be used as a server.HandlerFunc.
+func (p *ForwardProxy) Handle(w *response.Writer, req *request.Request) error {
+	if !p.authorized(req) {
+		log.Printf("Proxy: rejected unauthenticated %s %s from %s", req.RequestLine.Method, req.RequestLine.RequestTarget, req.RemoteAddr)
+		challenge := headers.NewHeaders()
+		challenge.Set("Proxy-Authenticate", fmt.Sprintf(`Basic realm="%s"`, p.opts.Realm))
+		return &server.HandleError{StatusCode: response.ProxyAuthRequired, Headers: challenge}
+	}
+
+	if req.RequestLine.Method == "CONNECT" {
+		return p.handleConnect(w, req)
+	}
+
+	u, err := url.Parse(req.RequestLine.RequestTarget)
+	if err != nil || u.Scheme != "http" || u.Host == "" {
+		// TLS to the destination goes through CONNECT, not through us
+		return &server.HandleError{StatusCode: response.BadRequest}
+	}
+
+	hostport := u.Host
+	if u.Port() == "" {
+		hostport = net.JoinHostPort(u.Hostname(), "80")
+	}
+	if !p.allowed(hostport) {
+		log.Printf("Proxy: denied %s %s from %s", req.RequestLine.Method, u.Redacted(), req.RemoteAddr)
+		return &server.HandleError{StatusCode: response.Forbidden}
+	}
+	addr, err := p.resolve(req.Context(), hostport)
+	if err != nil {
+		log.Printf("Proxy: %s %s from %s failed: %v", req.RequestLine.Method, u.Redacted(), req.RemoteAddr, err)
+		return resolveError(err)
+	}
+	log.Printf("Proxy: %s %s from %s", req.RequestLine.Method, u.Redacted(), req.RemoteAddr)
+
+	outReq, err := p.outgoingRequest(req, u)
+	if err != nil {
+		return requestError(err)
+	}
+	// Connect to the checked address, the name is only kept for the Host header
+	outReq.URL.Host = addr
+
+	resp, err := p.opts.Transport.RoundTrip(outReq)
+	if err != nil {
+		return upstreamError(err)
+	}
+	defer resp.Body.Close()
+
+	return p.relay.serveResponse(w, req, resp)
+}
+
+func (p *ForwardProxy) outgoingRequest(req *request.Request, u *url.URL) (*client.Request, error) {
+	// Reading the body sends 100 Continue if the client waits for it, the
+	// expectation is settled here and isn't forwarded
+	body, err := req.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+
+	outReq, err := client.NewRequest(req.Context(), upstreamMethod(req), u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range req.Headers {
+		outReq.Headers.Set(key, value)
+	}
+	removeHopByHop(outReq.Headers)
+	outReq.Headers.Del("Expect")
+	outReq.Headers.Set("Host", u.Host)
+
+	via := "1.1 go-http"
+	if prior := outReq.Headers.Get("Via"); prior != "" {
+		via = prior + ", " + via
+	}
+	outReq.Headers.Set("Via", via)
+
+	return outReq, nil
+}
+
+// handleConnect dials the requested host:port and splices the client
+// connection with it until either side closes.
+func (p *ForwardProxy) handleConnect(w *response.Writer, req *request.Request) error {
+	hostport := req.RequestLine.RequestTarget
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		return &server.HandleError{StatusCode: response.BadRequest}
+	}
+	if !p.allowed(hostport) {
+		log.Printf("Proxy: denied CONNECT %s from %s", hostport, req.RemoteAddr)
+		return &server.HandleError{StatusCode: response.Forbidden}
+	}
+	addr, err := p.resolve(req.Context(), hostport)
+	if err != nil {
+		log.Printf("Proxy: CONNECT %s from %s failed: %v", hostport, req.RemoteAddr, err)
+		return resolveError(err)
+	}
+	log.Printf("Proxy: CONNECT %s from %s", hostport, req.RemoteAddr)
+
+	dialer := &net.Dialer{Timeout: p.opts.DialTimeout}
+	upstream, err := dialer.DialContext(req.Context(), "tcp", addr)
+	if err != nil {
+		return upstreamError(err)
+	}
+	defer upstream.Close()
+
+	w.Headers = headers.NewHeaders()
+	w.Status = response.OK
+	if err := w.Flush(); err != nil {
+		log.Println("error: writing CONNECT response failed:", err)
+		return nil
+	}
+
+	client, err := w.Hijack()
+	if err != nil {
+		log.Println("error: hijacking connection failed:", err)
+		return nil
+	}
+
+	start := time.Now()
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(upstream, client)
+		// Let the target see EOF, then unblock the other direction if it doesn't close
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		upstream.SetReadDeadline(time.Now().Add(p.opts.Timeout))
+	}()
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(client, upstream)
+		client.SetReadDeadline(time.Now())
+	}()
+	wg.Wait()
+
+	log.Printf("Proxy: closed tunnel to %s from %s after %s, %d bytes sent, %d bytes received",
+		hostport, req.RemoteAddr, time.Since(start).Round(time.Millisecond), sent, received)
+	return nil
+}
+
+// authorized checks the Proxy-Authorization Basic credentials, if any are configured.
+func (p *ForwardProxy) authorized(req *request.Request) bool {
+	if p.opts.Username == "" && p.opts.Password == "" {
+		return true
+	}
+
+	scheme, encoded, ok := strings.Cut(req.Headers.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+
+	// Compare both so timing doesn't tell which one was wrong
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(p.opts.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(p.opts.Password)) == 1
+	return userOK && passOK
+}
+
+// allowed checks hostport against the port and host allowlists.
+func (p *ForwardProxy) allowed(hostport string) bool {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return false
+	}
+
+	portOK := false
+	for _, allowed := range p.opts.AllowedPorts {
+		if port == allowed {
+			portOK = true
+			break
+		}
+	}
+	if !portOK {
+		return false
+	}
+
+	if len(p.opts.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.opts.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve looks up the host of hostport and returns the first of its addresses
+// the proxy may connect to, as ip:port. Connecting to the checked address rather
+// than the name keeps a second lookup (DNS rebinding) from redirecting the request.
+func (p *ForwardProxy) resolve(ctx context.Context, hostport string) (string, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.DialTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range addrs {
+		if p.opts.AllowPrivateAddresses || !isInternalIP(addr.IP) {
+			return net.JoinHostPort(addr.IP.String(), port), nil
+		}
+	}
+	return "", errDeniedAddress
+}
+
+// isInternalIP reports whether ip belongs to this host or a private network.
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// resolveError answers a request whose destination couldn't be resolved or is denied.
+func resolveError(err error) error {
+	if errors.Is(err, errDeniedAddress) {
+		return &server.HandleError{StatusCode: response.Forbidden, Err: err}
+	}
+	return upstreamError(err)
+}
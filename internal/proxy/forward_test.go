@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/KDT2006/go-http/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardProxy(t *testing.T) {
+	var got *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Write([]byte("hello from upstream"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	p, err := NewForward(ForwardOptions{AllowedPorts: []int{port}, Username: "ci", Password: "s3cret", AllowPrivateAddresses: true})
+	require.NoError(t, err)
+	auth := "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("ci:s3cret")) + "\r\n"
+
+	// Test: Missing credentials
+	resp := proxyRequest(t, p.Handle, "GET "+upstream.URL+"/x HTTP/1.1\r\nHost: "+u.Host+"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 407 Proxy Authentication Required\r\n"))
+	assert.Contains(t, resp, "Proxy-Authenticate: Basic realm=\"proxy\"\r\n")
+
+	// Test: Absolute-form request is forwarded without the proxy credentials
+	resp = proxyRequest(t, p.Handle, "GET "+upstream.URL+"/x?y=1 HTTP/1.1\r\nHost: "+u.Host+"\r\n"+auth+"\r\n")
+	assert.True(t, strings.HasSuffix(resp, "hello from upstream"))
+	require.NotNil(t, got)
+	assert.Equal(t, "/x", got.URL.Path)
+	assert.Equal(t, "y=1", got.URL.RawQuery)
+	assert.Empty(t, got.Header.Get("Proxy-Authorization"))
+	assert.Equal(t, "1.1 go-http", got.Header.Get("Via"))
+	assert.Equal(t, u.Host, got.Host)
+
+	// Test: Ports and hosts outside the allowlist
+	resp = proxyRequest(t, p.Handle, "GET http://example.com:8081/ HTTP/1.1\r\nHost: example.com\r\n"+auth+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+	p, err = NewForward(ForwardOptions{AllowedPorts: []int{port}, AllowedHosts: []string{"*.internal"}})
+	require.NoError(t, err)
+	resp = proxyRequest(t, p.Handle, "GET "+upstream.URL+"/ HTTP/1.1\r\nHost: "+u.Host+"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+	assert.True(t, p.allowed("api.internal:"+u.Port()))
+	assert.False(t, p.allowed("internal.evil:"+u.Port()))
+
+	// Test: An open proxy is refused
+	_, err = NewForward(ForwardOptions{})
+	assert.Error(t, err)
+}
+
+func TestForwardProxyInternalAddresses(t *testing.T) {
+	p, err := NewForward(ForwardOptions{Username: "ci", Password: "s3cret"})
+	require.NoError(t, err)
+	auth := "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("ci:s3cret")) + "\r\n"
+
+	// Test: Loopback, private and link-local destinations are denied, by IP or by name
+	for _, target := range []string{"127.0.0.1", "localhost", "10.0.0.1", "192.168.1.1", "169.254.169.254", "[::1]", "[fe80::1]", "0.0.0.0"} {
+		resp := proxyRequest(t, p.Handle, "GET http://"+target+"/ HTTP/1.1\r\nHost: "+target+"\r\n"+auth+"\r\n")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"), target)
+		resp = proxyRequest(t, p.Handle, "CONNECT "+target+":443 HTTP/1.1\r\nHost: "+target+":443\r\n"+auth+"\r\n")
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"), target)
+	}
+
+	// Test: Public addresses resolve to themselves
+	addr, err := p.resolve(context.Background(), "93.184.215.14:80")
+	require.NoError(t, err)
+	assert.Equal(t, "93.184.215.14:80", addr)
+}
+
+func TestConnectTunnel(t *testing.T) {
+	// Echo server as the tunnel's destination
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	_, echoPort, _ := net.SplitHostPort(echo.Addr().String())
+	port, _ := strconv.Atoi(echoPort)
+
+	p, err := NewForward(ForwardOptions{AllowedPorts: []int{port}, AllowedHosts: []string{"127.0.0.1"}, AllowPrivateAddresses: true})
+	require.NoError(t, err)
+	srv, err := server.Serve(0, p.Handle)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("CONNECT " + echo.Addr().String() + " HTTP/1.1\r\nHost: " + echo.Addr().String() + "\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: 200 without framing headers, then raw bytes flow both ways
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.NotContains(t, line, "Content-Length")
+		assert.NotContains(t, line, "Transfer-Encoding")
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	_, err = conn.Write([]byte("ping through the tunnel"))
+	require.NoError(t, err)
+	buf := make([]byte, len("ping through the tunnel"))
+	_, err = io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping through the tunnel", string(buf))
+}
@@ -0,0 +1,451 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/client"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+// hopByHopHeaders only apply to a single connection and must not be forwarded (RFC 9110 Section 7.6.1).
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+const defaultTimeout = 30 * time.Second
+
+type Options struct {
+	// StripPrefix is removed from the request path before it's appended to the
+	// target's path, requests whose path isn't under it get a 404
+	StripPrefix string
+	// PreserveHost forwards the client's Host header instead of the target's host
+	PreserveHost bool
+	// Timeout limits how long to wait for the upstream response headers, defaults to 30s
+	Timeout time.Duration
+	// Transport sends the upstream requests, defaults to a client.PooledTransport
+	Transport client.RoundTripper
+}
+
+// ReverseProxy forwards requests to a single upstream server.
+type ReverseProxy struct {
+	target *url.URL
+	opts   Options
+}
+
+// New creates a ReverseProxy forwarding to target, e.g. "http://localhost:8080/api".
+func New(target string, opts Options) (*ReverseProxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("error: unsupported upstream scheme: %q", u.Scheme)
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Transport == nil {
+		opts.Transport = &client.PooledTransport{Transport: client.Transport{ResponseHeaderTimeout: opts.Timeout}}
+	}
+
+	return &ReverseProxy{target: u, opts: opts}, nil
+}
+
+// Handle proxies req to the upstream server, it can be used as a server.HandlerFunc.
+func (p *ReverseProxy) Handle(w *response.Writer, req *request.Request) error {
+	outReq, err := p.outgoingRequest(req)
+	if err != nil {
+		return requestError(err)
+	}
+
+	resp, err := p.opts.Transport.RoundTrip(outReq)
+	if err != nil {
+		return upstreamError(err)
+	}
+	defer resp.Body.Close()
+
+	return p.serveResponse(w, req, resp)
+}
+
+// serveResponse relays an upstream response to the client. Failures once the
+// response is underway are only logged, it returns an error for the handler otherwise.
+func (p *ReverseProxy) serveResponse(w *response.Writer, req *request.Request, resp *client.Response) error {
+	if resp.StatusCode == response.SwitchingProtocols {
+		return p.handleUpgrade(w, req, resp)
+	}
+
+	// Announce upstream trailers so they can be relayed once the body is done
+	for _, name := range strings.Split(resp.Headers.Get("Trailer"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if err := w.DeclareTrailer(name); err != nil {
+			log.Println("error: dropping upstream trailer:", err)
+		}
+	}
+
+	p.copyResponseHeaders(w, req, resp)
+	w.Status = resp.StatusCode
+
+	err := p.copyBody(w, resp)
+	if err != nil {
+		// The status line is most likely out already, all we can do is cut the response short
+		log.Println("error: copying upstream body failed:", err)
+		return nil
+	}
+
+	for name, value := range resp.Trailers {
+		w.SetTrailer(name, value)
+	}
+	return nil
+}
+
+func (p *ReverseProxy) outgoingRequest(req *request.Request) (*client.Request, error) {
+	target, query, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	if p.opts.StripPrefix != "" {
+		trimmed, ok := strings.CutPrefix(target, strings.TrimSuffix(p.opts.StripPrefix, "/"))
+		// The prefix must end at a segment boundary, "/apix" isn't under "/api/"
+		if !ok || (trimmed != "" && trimmed[0] != '/') {
+			return nil, &server.HandleError{StatusCode: response.NotFound}
+		}
+		target = trimmed
+	}
+
+	// Dot segments are resolved before joining so they can't climb out of the
+	// upstream's base path, encoded ones that survive cleaning are refused
+	target = cleanPath(target)
+	unescaped, err := url.PathUnescape(target)
+	if err != nil || slices.Contains(strings.Split(unescaped, "/"), "..") {
+		return nil, &server.HandleError{StatusCode: response.BadRequest}
+	}
+
+	u := *p.target
+	u.Path = singleJoiningSlash(p.target.Path, unescaped)
+	u.RawPath = singleJoiningSlash(p.target.EscapedPath(), target)
+	u.RawQuery = p.target.RawQuery
+	if query != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += query
+	}
+
+	// Reading the body sends 100 Continue if the client waits for it, the
+	// expectation is settled here and isn't forwarded
+	body, err := req.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+
+	outReq, err := client.NewRequest(req.Context(), upstreamMethod(req), u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	upgrade := isUpgrade(req.Headers)
+	for key, value := range req.Headers {
+		outReq.Headers.Set(key, value)
+	}
+	removeHopByHop(outReq.Headers)
+	outReq.Headers.Del("Expect")
+	// Upgrades are the one hop-by-hop mechanism a proxy has to pass along
+	if upgrade {
+		outReq.Headers.Set("Connection", "Upgrade")
+		outReq.Headers.Set("Upgrade", req.Headers.Get("Upgrade"))
+	}
+	outReq.Headers.Del("Host")
+
+	host := req.Headers.Get("Host")
+	if p.opts.PreserveHost && host != "" {
+		outReq.Headers.Set("Host", host)
+	}
+
+	setForwardedHeaders(outReq.Headers, req.RemoteAddr, host)
+
+	return outReq, nil
+}
+
+// upstreamMethod returns the method to send upstream, HEAD requests served
+// as GET stay HEAD so the upstream doesn't send a body only to be discarded.
+func upstreamMethod(req *request.Request) string {
+	if req.IsHead() {
+		return "HEAD"
+	}
+	return req.RequestLine.Method
+}
+
+// setForwardedHeaders appends the client to X-Forwarded-For and Forwarded
+// and records the original host and protocol.
+func setForwardedHeaders(h headers.Headers, remoteAddr string, host string) {
+	clientIP, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		clientIP = remoteAddr
+	}
+
+	if clientIP != "" {
+		if prior := h.Get("X-Forwarded-For"); prior != "" {
+			h.Set("X-Forwarded-For", prior+", "+clientIP)
+		} else {
+			h.Set("X-Forwarded-For", clientIP)
+		}
+	}
+	if host != "" {
+		h.Set("X-Forwarded-Host", host)
+	}
+	h.Set("X-Forwarded-Proto", "http")
+
+	// Forwarded (RFC 7239) quotes IPv6 addresses and anything that isn't a token
+	forwardedFor := clientIP
+	if strings.Contains(clientIP, ":") {
+		forwardedFor = fmt.Sprintf(`"[%s]"`, clientIP)
+	}
+	element := "proto=http"
+	if forwardedFor != "" {
+		element = "for=" + forwardedFor + ";" + element
+	}
+	if host != "" {
+		element += ";host=" + quotedString(host)
+	}
+	if prior := h.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	h.Set("Forwarded", element)
+}
+
+// quotedString quotes s as a quoted-string (RFC 9110 Section 5.6.4).
+func quotedString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (p *ReverseProxy) copyResponseHeaders(w *response.Writer, req *request.Request, resp *client.Response) {
+	removeHopByHop(resp.Headers)
+
+	w.Headers = headers.NewHeaders()
+	for key, value := range resp.Headers {
+		w.Headers.Set(key, value)
+	}
+	for _, value := range resp.SetCookies {
+		w.AddSetCookieLine(value)
+	}
+
+	// Without a fixed target (forward proxying) redirects are passed through
+	if location := w.Headers.Get("Location"); location != "" && p.target != nil {
+		w.Headers.Set("Location", p.rewriteLocation(location, req.Headers.Get("Host")))
+	}
+}
+
+// rewriteLocation maps redirects pointing at the upstream back onto the proxy.
+func (p *ReverseProxy) rewriteLocation(location string, host string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	prefix := strings.TrimSuffix(p.opts.StripPrefix, "/")
+	if u.IsAbs() {
+		if !strings.EqualFold(u.Host, p.target.Host) || host == "" {
+			return location // Redirect to somewhere else entirely
+		}
+		u.Scheme = "http"
+		u.Host = host
+	} else if !strings.HasPrefix(u.Path, "/") {
+		return location // Relative paths resolve correctly on their own
+	}
+
+	// Undo the target's base path and restore the stripped prefix
+	upstreamPath := strings.TrimSuffix(p.target.Path, "/")
+	if upstreamPath != "" && strings.HasPrefix(u.Path, upstreamPath) {
+		u.Path = strings.TrimPrefix(u.Path, upstreamPath)
+	}
+	u.Path = prefix + u.Path
+	u.RawPath = ""
+	return u.String()
+}
+
+// copyBody streams the upstream body, flushing after every read when
+// its length is unknown so streamed responses (e.g. SSE) aren't held back.
+func (p *ReverseProxy) copyBody(w *response.Writer, resp *client.Response) error {
+	if resp.Request.Method == "HEAD" {
+		return nil // The copied headers already describe the body
+	}
+	if resp.ContentLength >= 0 {
+		w.Headers.Set("Content-Length", fmt.Sprint(resp.ContentLength))
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if ferr := w.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleUpgrade completes a protocol switch (e.g. WebSocket) and splices
+// the client and upstream connections until either side closes.
+func (p *ReverseProxy) handleUpgrade(w *response.Writer, req *request.Request, resp *client.Response) error {
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return &server.HandleError{StatusCode: response.BadGateway, Err: errors.New("error: upstream switched protocols without a writable body")}
+	}
+
+	w.Headers = headers.NewHeaders()
+	for key, value := range resp.Headers {
+		w.Headers.Set(key, value)
+	}
+	w.Status = response.SwitchingProtocols
+	if err := w.Flush(); err != nil {
+		log.Println("error: writing 101 response failed:", err)
+		return nil
+	}
+
+	conn, err := w.Hijack()
+	if err != nil {
+		log.Println("error: hijacking connection failed:", err)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, upstream)
+		// Unblock the other direction
+		conn.SetReadDeadline(time.Now())
+	}()
+	wg.Wait()
+	return nil
+}
+
+func isUpgrade(h headers.Headers) bool {
+	if h.Get("Upgrade") == "" {
+		return false
+	}
+	for _, token := range strings.Split(h.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// removeHopByHop deletes hop-by-hop headers, including any listed in Connection.
+func removeHopByHop(h headers.Headers) {
+	for _, name := range strings.Split(h.Get("Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			h.Del(name)
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// singleJoiningSlash joins a and b with one slash between them, without cleaning.
+func singleJoiningSlash(a string, b string) string {
+	if b == "" {
+		b = "/"
+	}
+	if a == "" {
+		return b
+	}
+	aSlash := strings.HasSuffix(a, "/")
+	bSlash := strings.HasPrefix(b, "/")
+	switch {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// cleanPath resolves "." and ".." segments of target, keeping a trailing slash.
+func cleanPath(target string) string {
+	if target == "" {
+		return ""
+	}
+	cleaned := path.Clean(target)
+	if cleaned != "/" && strings.HasSuffix(target, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// requestError answers a request that couldn't be turned into an upstream request,
+// e.g. because its body couldn't be read.
+func requestError(err error) error {
+	var handleErr *server.HandleError
+	var parseErr *request.ParseError
+	if errors.As(err, &handleErr) || errors.As(err, &parseErr) {
+		return err // The server answers body errors with 400 or 413
+	}
+	return &server.HandleError{StatusCode: response.BadRequest, Err: err}
+}
+
+// upstreamError answers a failed upstream request with 504 for timeouts and 502 otherwise.
+func upstreamError(err error) error {
+	if isTimeout(err) {
+		return &server.HandleError{StatusCode: response.GatewayTimeout, Err: err}
+	}
+	return &server.HandleError{StatusCode: response.BadGateway, Err: err}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyRequest(t *testing.T, handler server.HandlerFunc, raw string) string {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.1:5000"
+
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	server.WriteError(w, req, handler(w, req))
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestReverseProxy(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+
+		switch r.URL.Path {
+		case "/api/redirect":
+			http.Redirect(w, r, "http://"+r.Host+"/api/target", http.StatusFound)
+		case "/api/stream":
+			w.Header().Set("Trailer", "X-Checksum, Content-Length")
+			w.Write([]byte("part one,"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("part two"))
+			w.Header().Set("X-Checksum", "abc")
+		default:
+			w.Header().Set("Connection", "X-Hop")
+			w.Header().Set("X-Hop", "secret")
+			w.Header().Add("Set-Cookie", "a=1")
+			w.Header().Add("Set-Cookie", "b=2")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		}
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL+"/api", Options{StripPrefix: "/proxy/"})
+	require.NoError(t, err)
+
+	// Test: Method, body, path and forwarding headers reach the upstream
+	resp := proxyRequest(t, p.Handle, "POST /proxy/items?x=1 HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nConnection: keep-alive, X-Drop\r\nX-Drop: 1\r\nX-Keep: 2\r\nX-Forwarded-For: 198.51.100.7\r\n\r\nhello")
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/api/items", got.URL.Path)
+	assert.Equal(t, "x=1", got.URL.RawQuery)
+	assert.Equal(t, "hello", gotBody)
+	assert.Equal(t, "2", got.Header.Get("X-Keep"))
+	assert.Empty(t, got.Header.Get("X-Drop"))
+	assert.Equal(t, "198.51.100.7, 192.0.2.1", got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", got.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, `for=192.0.2.1;proto=http;host="example.com"`, got.Header.Get("Forwarded"))
+
+	// Test: Status, cookies and body come back, hop-by-hop headers don't
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 201 Created\r\n"))
+	assert.Contains(t, resp, "Set-Cookie: a=1\r\n")
+	assert.Contains(t, resp, "Set-Cookie: b=2\r\n")
+	assert.NotContains(t, resp, "X-Hop")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\ncreated"))
+
+	// Test: Location pointing at the upstream is rewritten onto the proxy
+	resp = proxyRequest(t, p.Handle, "GET /proxy/redirect HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 302 Found\r\n"))
+	assert.Contains(t, resp, "Location: http://example.com/proxy/target\r\n")
+
+	// Test: Streamed bodies and trailers are relayed chunked
+	resp = proxyRequest(t, p.Handle, "GET /proxy/stream HTTP/1.1\r\nHost: example.com\r\nTE: trailers\r\n\r\n")
+	assert.Contains(t, resp, "Transfer-Encoding: chunked\r\n")
+	assert.Contains(t, resp, "part one,")
+	assert.Contains(t, resp, "part two")
+	assert.Contains(t, resp, "X-Checksum: abc\r\n")
+	assert.Contains(t, resp, "Trailer: X-Checksum\r\n")
+
+	// Test: Paths not under StripPrefix
+	resp = proxyRequest(t, p.Handle, "GET /proxyitems HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+	resp = proxyRequest(t, p.Handle, "GET /proxy HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 201 Created\r\n"))
+	assert.Equal(t, "/api/", got.URL.Path)
+
+	// Test: Escaped paths aren't escaped twice
+	proxyRequest(t, p.Handle, "GET /proxy/a%20b%2Fc HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, "/api/a%20b%2Fc", got.URL.EscapedPath())
+
+	// Test: Dot segments can't leave the upstream base path
+	proxyRequest(t, p.Handle, "GET /proxy/../admin HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, "/api/admin", got.URL.Path)
+	resp = proxyRequest(t, p.Handle, "GET /proxy/%2e%2e/admin HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+
+	// Test: Upstream query is kept, without a separator for an empty one
+	withQuery, err := New(upstream.URL+"/api?k=v", Options{})
+	require.NoError(t, err)
+	proxyRequest(t, withQuery.Handle, "GET /items HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, "k=v", got.URL.RawQuery)
+	proxyRequest(t, withQuery.Handle, "GET /items?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, "k=v&x=1", got.URL.RawQuery)
+
+	// Test: Quotes and backslashes in the host are escaped in Forwarded
+	proxyRequest(t, p.Handle, "GET /proxy/items HTTP/1.1\r\nHost: a\"b\\c\r\n\r\n")
+	assert.Equal(t, `for=192.0.2.1;proto=http;host="a\"b\\c"`, got.Header.Get("Forwarded"))
+
+	// Test: HEAD served as GET goes upstream as HEAD
+	req, err := request.RequestFromReader(strings.NewReader("HEAD /proxy/items HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.NoError(t, err)
+	req.ServeAsGet()
+	buf := new(bytes.Buffer)
+	w := response.NewWriter(buf, req)
+	require.Nil(t, p.Handle(w, req))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HEAD", got.Method)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 201 Created\r\n"))
+	assert.Contains(t, strings.ToLower(buf.String()), "content-length: 7\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+}
+
+func TestReverseProxyErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstream.Close()
+
+	// Test: Unreachable upstream is a 502
+	p, err := New(upstream.URL, Options{})
+	require.NoError(t, err)
+	resp := proxyRequest(t, p.Handle, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 502 Bad Gateway\r\n"))
+
+	// Test: Unsupported scheme
+	_, err = New("ftp://example.com", Options{})
+	require.Error(t, err)
+}
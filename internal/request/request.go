@@ -2,11 +2,15 @@ package request
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
 
+	"github.com/KDT2006/go-http/internal/chunked"
+	"github.com/KDT2006/go-http/internal/cookie"
 	"github.com/KDT2006/go-http/internal/headers"
 )
 
@@ -19,13 +23,44 @@ const (
 	DONE
 	PARSING_HEADERS
 	PARSING_BODY
+	PARSING_CHUNKED
 )
 
+// ErrBodyTooLarge is returned when a request body exceeds a size limit.
+var ErrBodyTooLarge = errors.New("error: request body too large")
+
 type Request struct {
 	RequestLine RequestLine
 	State       int
 	Headers     headers.Headers
 	Body        []byte
+
+	// Trailers sent after a chunked body, fields forbidden in trailers are dropped
+	Trailers headers.Headers
+
+	// RemoteAddr is the client's address, set by the server
+	RemoteAddr string
+	// ID identifies the request in logs, set by the server from
+	// the client's X-Request-ID or generated
+	ID string
+
+	// chunked decodes a chunked body
+	chunked chunked.Decoder
+
+	// reader and buf hold the connection and unparsed bytes between HeadFromReader and ReadBody
+	reader     io.Reader
+	buf        []byte
+	headOnly   bool
+	onBodyRead func() error
+	onBodyDone func()
+	bodyErr    error
+	// maxBodySize caps the body, 0 means no limit. See SetMaxBodySize
+	maxBodySize int64
+
+	// ctx is set by the server, see Context
+	ctx context.Context
+	// head is set once a HEAD request is served as GET, see IsHead
+	head bool
 }
 
 type RequestLine struct {
@@ -34,52 +69,248 @@ type RequestLine struct {
 	Method        string
 }
 
+// IsHead reports whether the client sent a HEAD request. The server serves those
+// with the GET handler, so RequestLine.Method reads "GET" while this stays true.
+func (r *Request) IsHead() bool {
+	return r.head || r.RequestLine.Method == "HEAD"
+}
+
+// ServeAsGet turns a HEAD request into a GET one so GET handlers serve it,
+// IsHead keeps reporting the original method.
+func (r *Request) ServeAsGet() {
+	if r.RequestLine.Method == "HEAD" {
+		r.head = true
+		r.RequestLine.Method = "GET"
+	}
+}
+
+// Context returns the request's context. For requests served by the server it's
+// cancelled when the client disconnects, the write timeout passes or the server
+// is closed, context.Cause tells which. Disconnects of clients that sent
+// Expect: 100-continue are only noticed once the body has been read.
+// It's context.Background() otherwise.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r using ctx, e.g. for middleware to add request-scoped values.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// Cookies parses and returns the cookies sent in the Cookie header.
+func (r *Request) Cookies() []*cookie.Cookie {
+	if r.Headers == nil {
+		return []*cookie.Cookie{}
+	}
+	return cookie.Parse(r.Headers.Get("Cookie"))
+}
+
+// Cookie returns the first cookie with the given name.
+func (r *Request) Cookie(name string) (*cookie.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("error: cookie %q not present", name)
+}
+
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, 0, bufferSize)
 	request := &Request{
-		State: INITIALIZED,
+		State:  INITIALIZED,
+		reader: reader,
 	}
 
-	for request.State != DONE {
+	err := request.readUntilDone()
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// HeadFromReader parses the request line and headers only. The body is left
+// unread until ReadBody is called, which lets the server answer
+// "Expect: 100-continue" before the client sends it.
+func HeadFromReader(reader io.Reader) (*Request, error) {
+	request := &Request{
+		State:    INITIALIZED,
+		reader:   reader,
+		headOnly: true,
+	}
+
+	err := request.readUntilDone()
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// ReadBody returns the body, reading it first if the request was parsed by HeadFromReader.
+// The first call runs the hook set with OnBodyRead, e.g. to send 100 Continue.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.State == DONE {
+		return r.Body, nil
+	}
+	if r.bodyErr != nil {
+		return nil, r.bodyErr
+	}
+
+	// Bodies announced too large are refused before asking for them with 100 Continue
+	if contentLength, err := strconv.ParseInt(r.Headers.Get("Content-Length"), 10, 64); err == nil &&
+		r.maxBodySize > 0 && contentLength > r.maxBodySize {
+		r.bodyErr = &ParseError{Kind: "body", Err: fmt.Errorf("%w: Content-Length %d", ErrBodyTooLarge, contentLength)}
+		return nil, r.bodyErr
+	}
+
+	if r.onBodyRead != nil && r.hasBody() {
+		hook := r.onBodyRead
+		r.onBodyRead = nil
+		if err := hook(); err != nil {
+			r.bodyErr = err
+			return nil, err
+		}
+	}
+
+	r.headOnly = false
+	if err := r.readUntilDone(); err != nil {
+		r.bodyErr = err
+		return nil, err
+	}
+	if r.onBodyDone != nil {
+		hook := r.onBodyDone
+		r.onBodyDone = nil
+		hook()
+	}
+	return r.Body, nil
+}
+
+// SetMaxBodySize caps the body read by ReadBody, larger bodies fail with
+// ErrBodyTooLarge. 0 means no limit.
+func (r *Request) SetMaxBodySize(n int64) {
+	r.maxBodySize = n
+}
+
+// MaxBodySize returns the cap set with SetMaxBodySize, 0 if there's none.
+func (r *Request) MaxBodySize() int64 {
+	return r.maxBodySize
+}
+
+// OnBodyRead sets a hook that runs right before the body is read by ReadBody.
+func (r *Request) OnBodyRead(hook func() error) {
+	r.onBodyRead = hook
+}
+
+// OnBodyDone sets a hook that runs once ReadBody has read the whole body.
+func (r *Request) OnBodyDone(hook func()) {
+	r.onBodyDone = hook
+}
+
+// ExpectsContinue reports whether the client waits for 100 Continue before sending the body.
+func (r *Request) ExpectsContinue() bool {
+	return strings.EqualFold(r.Headers.Get("Expect"), "100-continue")
+}
+
+// hasBody reports whether the headers announce a body.
+func (r *Request) hasBody() bool {
+	contentLength := r.Headers.Get("Content-Length")
+	return r.Headers.Get("Transfer-Encoding") != "" || (contentLength != "" && contentLength != "0")
+}
+
+// BodyRead reports whether the body has been read, it's false for requests
+// parsed by HeadFromReader until ReadBody is called.
+func (r *Request) BodyRead() bool {
+	return r.State == DONE
+}
+
+// readUntilDone reads and parses until the request is complete,
+// or until the headers are done when only the head is wanted.
+func (r *Request) readUntilDone() error {
+	for !r.stopped() {
+		// Parse what's left over from earlier reads first
+		parsed, err := r.parse(r.buf)
+		if err != nil {
+			return r.parseError(err)
+		}
+		r.buf = r.buf[parsed:]
+		if r.stopped() {
+			break
+		}
+
 		// Temporary buffer for reading
 		tmpBuf := make([]byte, bufferSize)
-		n, err := reader.Read(tmpBuf)
+		n, err := r.reader.Read(tmpBuf)
 		if err != nil {
 			if err == io.EOF {
+				// Give the parser a last look at the remaining data
+				parsed, perr := r.parse(r.buf)
+				if perr != nil {
+					return r.parseError(perr)
+				}
+				r.buf = r.buf[parsed:]
 				break
 			}
-			return nil, err
+			return &ParseError{Kind: "read", Err: err}
 		}
 
 		// Append new data to accumulated buffer
-		buf = append(buf, tmpBuf[:n]...)
+		r.buf = append(r.buf, tmpBuf[:n]...)
+	}
 
-		// Try to parse
-		parsed, err := request.parse(buf)
-		if err != nil {
-			return nil, err
-		}
+	if !r.stopped() {
+		return &ParseError{Kind: "incomplete", Err: fmt.Errorf("incomplete request")}
+	}
 
-		// fmt.Printf("%+v\n", *request)
+	return nil
+}
 
-		if parsed > 0 {
-			buf = buf[parsed:]
-		}
-	}
+// ParseError is returned when a request can't be read or parsed.
+type ParseError struct {
+	// Kind tells where it failed: "request_line", "headers", "body", "incomplete"
+	// if the client closed the connection early or "read" for other read errors
+	Kind string
+	Err  error
+}
 
-	if request.State != DONE {
-		return nil, fmt.Errorf("incomplete request")
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError wraps an error of the parser with the part of the request it was parsing.
+func (r *Request) parseError(err error) error {
+	kind := "body"
+	switch r.State {
+	case INITIALIZED:
+		kind = "request_line"
+	case PARSING_HEADERS:
+		kind = "headers"
 	}
+	return &ParseError{Kind: kind, Err: err}
+}
 
-	return request, nil
+// stopped reports whether parsing is done for now.
+func (r *Request) stopped() bool {
+	return r.State == DONE || (r.headOnly && r.State == PARSING_BODY)
 }
 
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
 
-	for r.State != DONE {
+	for !r.stopped() {
 		// fmt.Println("Size of data: ", len(data))
 		// fmt.Println("totalBytesParsed: ", totalBytesParsed)
+		prevState := r.State
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		// fmt.Println("n: ", n)
 		if err != nil {
@@ -87,7 +318,7 @@ func (r *Request) parse(data []byte) (int, error) {
 		}
 		totalBytesParsed += n
 
-		if n == 0 {
+		if n == 0 && r.State == prevState {
 			break // need more data
 		}
 	}
@@ -130,6 +361,15 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		return n, nil
 
 	case PARSING_BODY:
+		// Transfer-Encoding takes precedence over Content-Length (RFC 9112 Section 6.3)
+		if te := r.Headers.Get("Transfer-Encoding"); te != "" {
+			if !strings.EqualFold(strings.TrimSpace(te[strings.LastIndex(te, ",")+1:]), "chunked") {
+				return 0, fmt.Errorf("error: unsupported Transfer-Encoding: %s", te)
+			}
+			r.State = PARSING_CHUNKED
+			return 0, nil
+		}
+
 		// Check for Content-Length header(which indicates a body)
 		if r.Headers.Get("Content-Length") == "" {
 			r.State = DONE
@@ -159,6 +399,27 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		// Report that you've consumed the entire length of the data you were given
 		return len(data), nil
 
+	case PARSING_CHUNKED:
+		n, chunk, err := r.chunked.Decode(data)
+		if errors.Is(err, chunked.ErrChunkTooLarge) {
+			return 0, fmt.Errorf("%w: chunk over %d bytes", ErrBodyTooLarge, chunked.MaxChunkSize)
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.Body = append(r.Body, chunk...)
+
+		// Checked as soon as the chunk size is known
+		if r.maxBodySize > 0 && int64(len(r.Body))+r.chunked.Remaining() > r.maxBodySize {
+			return 0, fmt.Errorf("%w: over %d bytes", ErrBodyTooLarge, r.maxBodySize)
+		}
+
+		if r.chunked.Done() {
+			r.Trailers = r.chunked.Trailers
+			r.State = DONE
+		}
+		return n, nil
+
 	default:
 		return 0, fmt.Errorf("error: unknown state")
 	}
@@ -186,3 +186,181 @@ func TestParseBody(t *testing.T) {
 	require.NotNil(t, r)
 	assert.Equal(t, "", string(r.Body))
 }
+
+func TestCookies(t *testing.T) {
+	reader := &chunkReader{
+		data: "GET / HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Cookie: session=abc123; theme=dark\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.Len(t, r.Cookies(), 2)
+
+	c, err := r.Cookie("theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", c.Value)
+
+	_, err = r.Cookie("missing")
+	require.Error(t, err)
+
+	// Test: Multiple Cookie lines
+	r, err = RequestFromReader(&chunkReader{data: "GET / HTTP/1.1\r\nHost: localhost\r\nCookie: a=1\r\nCookie: b=2\r\n\r\n", numBytesPerRead: 3})
+	require.NoError(t, err)
+	require.Len(t, r.Cookies(), 2)
+	assert.Equal(t, "b", r.Cookies()[1].Name)
+}
+
+func TestParseChunkedBody(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"5;ext=1\r\n" +
+			"hello\r\n" +
+			"7\r\n" +
+			" world!\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers.Get("X-Checksum"))
+	assert.Equal(t, "", r.Trailers.Get("Content-Length"))
+
+	// Test: Chunked body without trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+	assert.Empty(t, r.Trailers)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nabc\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestHeadFromReader(t *testing.T) {
+	// Test: Body is only read on demand, after the hook ran
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Expect: 100-continue\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := HeadFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+	assert.True(t, r.ExpectsContinue())
+	assert.False(t, r.BodyRead())
+	assert.Less(t, reader.pos, len(reader.data))
+
+	hookCalls := 0
+	r.OnBodyRead(func() error {
+		hookCalls++
+		return nil
+	})
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.True(t, r.BodyRead())
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, 1, hookCalls)
+
+	// Test: No hook call for requests without a body
+	r, err = HeadFromReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 100-continue\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	require.NoError(t, err)
+	r.OnBodyRead(func() error {
+		hookCalls++
+		return nil
+	})
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Empty(t, body)
+	assert.Equal(t, 1, hookCalls)
+
+	// Test: Truncated body
+	r, err = HeadFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 20\r\n\r\nshort",
+		numBytesPerRead: 4,
+	})
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.Error(t, err)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	head := func(data string) *Request {
+		r, err := HeadFromReader(&chunkReader{data: data, numBytesPerRead: 4})
+		require.NoError(t, err)
+		r.SetMaxBodySize(5)
+		return r
+	}
+
+	// Test: Bodies within the limit
+	r := head("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello")
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: A Content-Length over the limit fails before the hook asks for the body
+	r = head("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 6\r\n\r\nhello!")
+	r.OnBodyRead(func() error {
+		t.Error("hook called for a body over the limit")
+		return nil
+	})
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked bodies growing over the limit
+	r = head("POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n3\r\ndef\r\n0\r\n\r\n")
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "body", parseErr.Kind)
+}
+
+func TestParseErrorKinds(t *testing.T) {
+	for data, kind := range map[string]string{
+		"GET / HTTP/2.0\r\n\r\n":                                      "request_line",
+		"GET / HTTP/1.1\r\nBad Header: x\r\n\r\n":                     "headers",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n": "body",
+		"GET / HTTP/1.1\r\nHost: local":                               "incomplete",
+	} {
+		_, err := RequestFromReader(&chunkReader{data: data, numBytesPerRead: 3})
+		var parseErr *ParseError
+		require.ErrorAs(t, err, &parseErr, data)
+		assert.Equal(t, kind, parseErr.Kind, data)
+	}
+}
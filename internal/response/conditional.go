@@ -0,0 +1,161 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+)
+
+// StrongETag returns a strong entity tag derived from the content's hash.
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak entity tag derived from the content's hash,
+// for representations that are semantically but not byte-for-byte equivalent.
+func WeakETag(content []byte) string {
+	return "W/" + StrongETag(content)
+}
+
+// FileETag returns an entity tag from a file's size and modification time,
+// avoiding having to hash the whole file. It's strong so If-Range can match it,
+// assuming a file keeping its size and modification time kept its bytes.
+func FileETag(size int64, modtime time.Time) string {
+	return fmt.Sprintf(`"%x-%x"`, modtime.UnixNano(), size)
+}
+
+// CheckPreconditions evaluates the request's conditional headers against the
+// ETag in w.Headers and modtime (zero if unknown), in the order given by
+// RFC 9110 Section 13.2.2. If a precondition fails it writes a 304 Not Modified
+// or 412 Precondition Failed response and returns true; the handler must then
+// not write a body. It's meant for resources that exist, "*" matches any of them.
+func CheckPreconditions(w *Writer, req *request.Request, modtime time.Time) bool {
+	if w.Headers == nil {
+		w.Headers = headers.NewHeaders()
+	}
+	etag := w.Headers.Get("ETag")
+	method := req.RequestLine.Method
+	isGetOrHead := method == "GET" || method == "HEAD"
+
+	// Step 1 and 2: If-Match, or If-Unmodified-Since in its absence
+	if ifMatch := req.Headers.Get("If-Match"); ifMatch != "" {
+		if !matchETag(ifMatch, etag, false) {
+			writePreconditionFailed(w)
+			return true
+		}
+	} else if since, ok := parseHTTPDate(req.Headers.Get("If-Unmodified-Since")); ok && !modtime.IsZero() {
+		if modtime.UTC().Truncate(time.Second).After(since) {
+			writePreconditionFailed(w)
+			return true
+		}
+	}
+
+	// Step 3 and 4: If-None-Match, or If-Modified-Since in its absence
+	if ifNoneMatch := req.Headers.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, etag, true) {
+			if isGetOrHead {
+				writeNotModified(w)
+			} else {
+				writePreconditionFailed(w)
+			}
+			return true
+		}
+	} else if since, ok := parseHTTPDate(req.Headers.Get("If-Modified-Since")); ok && isGetOrHead && !modtime.IsZero() {
+		if !modtime.UTC().Truncate(time.Second).After(since) {
+			writeNotModified(w)
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchETag reports whether etag matches the If-Match/If-None-Match field value,
+// using weak comparison for If-None-Match and strong comparison otherwise.
+// "*" matches the current representation even if it has no entity tag.
+func matchETag(field string, etag string, weak bool) bool {
+	if strings.TrimSpace(field) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range parseETagList(field) {
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETagList splits a comma separated list of entity tags. Entity tags may
+// contain commas, so the list is scanned quote by quote instead of split.
+func parseETagList(field string) []string {
+	etags := []string{}
+	for i := 0; i < len(field); {
+		switch {
+		case field[i] == ' ' || field[i] == '\t' || field[i] == ',':
+			i++
+		case strings.HasPrefix(field[i:], `W/"`) || field[i] == '"':
+			start := i
+			if field[i] == 'W' {
+				i += 2
+			}
+			end := strings.IndexByte(field[i+1:], '"')
+			if end == -1 {
+				return etags // Unterminated, ignore the rest
+			}
+			i += end + 2
+			etags = append(etags, field[start:i])
+		default:
+			// Skip anything that isn't an entity tag
+			for i < len(field) && field[i] != ',' {
+				i++
+			}
+		}
+	}
+	return etags
+}
+
+func parseHTTPDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(headers.TimeFormat, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// writeNotModified sends a 304 keeping the validators and caching headers but
+// dropping everything describing a body. Content-Type and Content-Length are
+// dropped when the headers are committed, after a body encoder has seen them.
+func writeNotModified(w *Writer) {
+	for _, key := range []string{"Content-Range", "Transfer-Encoding", "Trailer"} {
+		w.Headers.Del(key)
+	}
+	w.Status = NotModified
+	w.Flush()
+}
+
+func writePreconditionFailed(w *Writer) {
+	if err := w.writeError(PreconditionFailed, nil); err != nil {
+		log.Println("error: writeError() failed:", err)
+	}
+}
@@ -0,0 +1,285 @@
+package response
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+)
+
+// maxRanges is the most ranges a single request may ask for before the Range
+// header is ignored, bounding the parts of a multipart response. Overlapping
+// ranges are coalesced, so they can't repeat the same bytes (RFC 9110 Section 14.2).
+const maxRanges = 32
+
+// errUnsatisfiable is returned by ParseRange when none of the ranges overlap the content.
+var errUnsatisfiable = errors.New("error: range not satisfiable")
+
+// ByteRange is an inclusive byte range of a representation.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+func (r ByteRange) length() int64 {
+	return r.End - r.Start + 1
+}
+
+func (r ByteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)
+}
+
+// ParseRange parses a Range header value for content of the given size.
+// It returns nil ranges (and no error) if the header is invalid and should be
+// ignored, and errUnsatisfiable if no range overlaps the content. Overlapping
+// and adjacent ranges are coalesced, the result is sorted by position.
+func ParseRange(value string, size int64) ([]ByteRange, error) {
+	unit, specs, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, nil
+	}
+
+	ranges := []ByteRange{}
+	count := 0
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		count++
+		if count > maxRanges {
+			return nil, nil
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r ByteRange
+		if first == "" {
+			// Suffix range: the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 {
+				continue
+			}
+			r = ByteRange{Start: max(size-n, 0), End: size - 1}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				end = min(end, size-1)
+			}
+			r = ByteRange{Start: start, End: end}
+		}
+
+		// Unsatisfiable ranges are skipped, the request fails only if none are left
+		if r.Start >= size {
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiable
+	}
+	return coalesce(ranges), nil
+}
+
+// coalesce sorts ranges and merges the ones that overlap or touch.
+func coalesce(ranges []ByteRange) []ByteRange {
+	slices.SortFunc(ranges, func(a, b ByteRange) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// ServeContent writes content as the response body, answering conditional requests
+// with 304 or 412 (see CheckPreconditions) and Range requests with 206 Partial Content
+// (single or multipart/byteranges) or 416 Range Not Satisfiable.
+// modtime is used for If-Range, pass the zero time if it's unknown. Content-Type
+// is sniffed from content if the handler didn't set it.
+func ServeContent(w *Writer, req *request.Request, content io.ReadSeeker, modtime time.Time) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if w.Headers == nil {
+		w.Headers = headers.NewHeaders()
+	}
+	if !modtime.IsZero() && w.Headers.Get("Last-Modified") == "" {
+		w.Headers.Set("Last-Modified", modtime.UTC().Format(headers.TimeFormat))
+	}
+
+	// Type and length are known before a 304, so a body encoder treats it like the full response
+	contentType := w.Headers.Get("Content-Type")
+	if contentType == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(content, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		contentType = http.DetectContentType(buf[:n])
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		w.Headers.Set("Content-Type", contentType)
+	}
+	w.Headers.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	// Conditional requests are evaluated before Range (RFC 9110 Section 13.2.2)
+	if CheckPreconditions(w, req, modtime) {
+		return nil
+	}
+	w.Headers.Set("Accept-Ranges", "bytes")
+
+	isHead := w.IsHead()
+
+	// Range is only defined for GET, so HEAD requests served by GET handlers ignore it
+	var ranges []ByteRange
+	if rangeHeader := req.Headers.Get("Range"); rangeHeader != "" && req.RequestLine.Method == "GET" && !isHead &&
+		checkIfRange(req, w.Headers.Get("ETag"), modtime) {
+		ranges, err = ParseRange(rangeHeader, size)
+		if err == errUnsatisfiable && size == 0 {
+			// Nothing in an empty representation can be satisfied, but clients that
+			// send a Range with every request still get the (empty) content
+			ranges, err = nil, nil
+		}
+		if err == errUnsatisfiable {
+			h := headers.NewHeaders()
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return w.writeError(RangeNotSatisfiable, h)
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		// Full content
+		w.Headers.Set("Content-Length", strconv.FormatInt(size, 10))
+		if isHead {
+			return nil
+		}
+		_, err = io.CopyN(w, content, size)
+		return err
+
+	case 1:
+		r := ranges[0]
+		w.Status = PartialContent
+		w.Headers.Set("Content-Range", r.contentRange(size))
+		w.Headers.Set("Content-Length", strconv.FormatInt(r.length(), 10))
+		if isHead {
+			return nil
+		}
+		if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.CopyN(w, content, r.length())
+		return err
+
+	default:
+		return serveMultipart(w, content, ranges, size, contentType, isHead)
+	}
+}
+
+// serveMultipart writes ranges as a multipart/byteranges body (RFC 9110 Section 14.6).
+func serveMultipart(w *Writer, content io.ReadSeeker, ranges []ByteRange, size int64, contentType string, isHead bool) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	boundary := hex.EncodeToString(b)
+
+	partHeader := func(r ByteRange) string {
+		return fmt.Sprintf("\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n", boundary, contentType, r.contentRange(size))
+	}
+	closing := fmt.Sprintf("\r\n--%s--\r\n", boundary)
+
+	// Compute the full length up front so the response doesn't need chunking
+	var length int64
+	for _, r := range ranges {
+		length += int64(len(partHeader(r))) + r.length()
+	}
+	length += int64(len(closing))
+
+	w.Status = PartialContent
+	w.Headers.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	w.Headers.Set("Content-Length", strconv.FormatInt(length, 10))
+	if isHead {
+		return nil
+	}
+
+	for _, r := range ranges {
+		if _, err := w.Write([]byte(partHeader(r))); err != nil {
+			return err
+		}
+		if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, content, r.length()); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte(closing))
+	return err
+}
+
+// checkIfRange reports whether a Range request should be honored given its If-Range
+// precondition: the validator must be a strong ETag match or the exact Last-Modified date.
+func checkIfRange(req *request.Request, etag string, modtime time.Time) bool {
+	ifRange := strings.TrimSpace(req.Headers.Get("If-Range"))
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// Weak validators never match for If-Range
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+
+	if modtime.IsZero() {
+		return false
+	}
+	t, err := time.Parse(headers.TimeFormat, ifRange)
+	if err != nil {
+		return false
+	}
+	return modtime.UTC().Truncate(time.Second).Equal(t)
+}
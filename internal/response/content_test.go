@@ -0,0 +1,184 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	ranges, err := ParseRange("bytes=0-499", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 499}}, ranges)
+
+	// Test: Open ended, suffix and clamped ranges
+	ranges, err = ParseRange("bytes=900-, -100, 990-2000", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{900, 999}}, ranges)
+
+	// Test: Overlapping and adjacent ranges are coalesced and sorted
+	ranges, err = ParseRange("bytes=500-599, 0-99, 50-149, 150-199, 700-", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 199}, {500, 599}, {700, 999}}, ranges)
+	ranges, err = ParseRange("bytes="+strings.Repeat("0-,", maxRanges), 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 999}}, ranges)
+
+	// Test: Suffix larger than the content
+	ranges, err = ParseRange("bytes=-5000", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 999}}, ranges)
+
+	// Test: Unsatisfiable ranges are skipped, all unsatisfiable fails
+	ranges, err = ParseRange("bytes=2000-3000, 0-0", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 0}}, ranges)
+	_, err = ParseRange("bytes=1000-", 1000)
+	require.ErrorIs(t, err, errUnsatisfiable)
+
+	// Test: Invalid headers are ignored
+	for _, value := range []string{"items=0-1", "bytes=5-1", "bytes=a-b", "bytes=1", "bytes="} {
+		ranges, err = ParseRange(value, 1000)
+		require.NoError(t, err, value)
+		assert.Nil(t, ranges, value)
+	}
+}
+
+func serveContent(t *testing.T, extraHeaders string) string {
+	req, err := request.RequestFromReader(strings.NewReader("GET /file HTTP/1.1\r\nHost: localhost\r\n" + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, req)
+	w.Headers = map[string]string{"Content-Type": "text/plain", "ETag": `"v1"`}
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, ServeContent(w, req, strings.NewReader("0123456789"), modtime))
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestServeContentRanges(t *testing.T) {
+	// Test: Full content advertises range support
+	resp := serveContent(t, "")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "Accept-Ranges: bytes\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n0123456789"))
+
+	// Test: Single range
+	resp = serveContent(t, "Range: bytes=2-4\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, resp, "Content-Range: bytes 2-4/10\r\n")
+	assert.Contains(t, resp, "Content-Length: 3\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n234"))
+
+	// Test: Multiple ranges
+	resp = serveContent(t, "Range: bytes=0-1, -2\r\n")
+	assert.Contains(t, resp, "Content-Type: multipart/byteranges; boundary=")
+	assert.Contains(t, resp, "Content-Range: bytes 0-1/10\r\n\r\n01\r\n")
+	assert.Contains(t, resp, "Content-Range: bytes 8-9/10\r\n\r\n89\r\n")
+
+	// Test: Unsatisfiable
+	resp = serveContent(t, "Range: bytes=20-\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, resp, "Content-Range: bytes */10\r\n")
+
+	// Test: Repeated ranges don't repeat the content
+	resp = serveContent(t, "Range: bytes="+strings.Repeat("0-,", maxRanges)+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, resp, "Content-Range: bytes 0-9/10\r\n")
+	assert.Equal(t, 1, strings.Count(resp, "0123456789"))
+
+	// Test: Ranges of empty content are ignored rather than unsatisfiable
+	req, err := request.RequestFromReader(strings.NewReader("GET /empty HTTP/1.1\r\nHost: localhost\r\nRange: bytes=0-\r\n\r\n"))
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, req)
+	require.NoError(t, ServeContent(w, req, strings.NewReader(""), time.Time{}))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "Content-Length: 0\r\n")
+
+	// Test: If-Range with matching and stale validators
+	assert.Contains(t, serveContent(t, "Range: bytes=2-4\r\nIf-Range: \"v1\"\r\n"), "206 Partial Content")
+	assert.Contains(t, serveContent(t, "Range: bytes=2-4\r\nIf-Range: \"v0\"\r\n"), "200 OK")
+	assert.Contains(t, serveContent(t, "Range: bytes=2-4\r\nIf-Range: Tue, 02 Jan 2024 03:04:05 GMT\r\n"), "206 Partial Content")
+	assert.Contains(t, serveContent(t, "Range: bytes=2-4\r\nIf-Range: Mon, 01 Jan 2024 03:04:05 GMT\r\n"), "200 OK")
+}
+
+func checkPreconditions(t *testing.T, method string, extraHeaders string) (bool, string) {
+	req, err := request.RequestFromReader(strings.NewReader(method + " /doc HTTP/1.1\r\nHost: localhost\r\n" + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, req)
+	w.Headers = map[string]string{"Content-Type": "text/plain", "ETag": `"v2"`}
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	done := CheckPreconditions(w, req, modtime)
+	require.NoError(t, w.Close())
+	return done, buf.String()
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	// Test: No conditional headers
+	done, _ := checkPreconditions(t, "GET", "")
+	assert.False(t, done)
+
+	// Test: If-None-Match uses weak comparison and lists
+	done, resp := checkPreconditions(t, "GET", "If-None-Match: \"a\", W/\"v2\"\r\n")
+	assert.True(t, done)
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, resp, "ETag: \"v2\"\r\n")
+	assert.NotContains(t, resp, "Content-Length")
+	assert.NotContains(t, resp, "Content-Type")
+
+	done, _ = checkPreconditions(t, "GET", "If-None-Match: \"v1\"\r\n")
+	assert.False(t, done)
+
+	// Test: If-None-Match on unsafe methods fails with 412
+	done, resp = checkPreconditions(t, "PUT", "If-None-Match: *\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "412 Precondition Failed")
+
+	// Test: If-Match uses strong comparison
+	done, _ = checkPreconditions(t, "PUT", "If-Match: \"v2\"\r\n")
+	assert.False(t, done)
+	done, resp = checkPreconditions(t, "PUT", "If-Match: W/\"v2\"\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "412 Precondition Failed")
+
+	// Test: If-Modified-Since
+	done, resp = checkPreconditions(t, "GET", "If-Modified-Since: Tue, 02 Jan 2024 03:04:05 GMT\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "304 Not Modified")
+	done, _ = checkPreconditions(t, "GET", "If-Modified-Since: Mon, 01 Jan 2024 03:04:05 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	done, _ = checkPreconditions(t, "GET", "If-None-Match: \"v1\"\r\nIf-Modified-Since: Tue, 02 Jan 2024 03:04:05 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: If-Unmodified-Since
+	done, resp = checkPreconditions(t, "DELETE", "If-Unmodified-Since: Mon, 01 Jan 2024 03:04:05 GMT\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "412 Precondition Failed")
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	done, _ = checkPreconditions(t, "DELETE", "If-Match: \"v2\"\r\nIf-Unmodified-Since: Mon, 01 Jan 2024 03:04:05 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: "*" matches resources without an entity tag
+	req, err := request.RequestFromReader(strings.NewReader("PUT /doc HTTP/1.1\r\nHost: localhost\r\nIf-Match: *\r\n\r\n"))
+	require.NoError(t, err)
+	w := NewWriter(new(bytes.Buffer), req)
+	assert.False(t, CheckPreconditions(w, req, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+func TestParseETagList(t *testing.T) {
+	assert.Equal(t, []string{`"a,b"`, `W/"c"`, `""`}, parseETagList(`"a,b", W/"c" ,""`))
+	assert.Equal(t, []string{`"a"`}, parseETagList(`"a", junk, "b`))
+}
@@ -0,0 +1,77 @@
+package response
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NegotiateContentType picks the best of the available media types for an
+// Accept value (RFC 9110 Section 12.5.1), preferring earlier ones on ties.
+// An empty Accept accepts anything, "" is returned if nothing is acceptable.
+//
+// A range also matches media types with its subtype as structured syntax suffix,
+// e.g. "application/json" matches "application/problem+json" (RFC 6838 Section 4.2.8).
+func NegotiateContentType(accept string, available []string) string {
+	if len(available) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return available[0]
+	}
+
+	type mediaRange struct {
+		typ, subtype string
+		q            float64
+	}
+	var ranges []mediaRange
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(entry, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: strings.TrimSpace(typ), subtype: strings.TrimSpace(subtype), q: q})
+	}
+
+	best, bestQ := "", 0.0
+	for _, candidate := range available {
+		mediaType, _, _ := strings.Cut(candidate, ";")
+		typ, subtype, _ := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+
+		// The most specific matching range decides the quality
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 3
+			case r.typ == typ && strings.HasSuffix(subtype, "+"+r.subtype):
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
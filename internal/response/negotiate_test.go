@@ -0,0 +1,29 @@
+package response
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	available := []string{"text/plain", "text/html", "application/problem+json"}
+
+	// Test: No preference picks the first
+	assert.Equal(t, "text/plain", NegotiateContentType("", available))
+	assert.Equal(t, "text/plain", NegotiateContentType("*/*", available))
+
+	// Test: Browser Accept
+	assert.Equal(t, "text/html", NegotiateContentType("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", available))
+
+	// Test: JSON matches the +json suffix
+	assert.Equal(t, "application/problem+json", NegotiateContentType("application/json", available))
+
+	// Test: Quality values and specificity
+	assert.Equal(t, "text/html", NegotiateContentType("text/*;q=0.5, text/html", available))
+	assert.Equal(t, "application/problem+json", NegotiateContentType("text/*;q=0.1, */*;q=0.5", available))
+	assert.Equal(t, "text/html", NegotiateContentType("text/plain;q=0, text/*", available))
+
+	// Test: Nothing acceptable
+	assert.Equal(t, "", NegotiateContentType("image/png", available))
+}
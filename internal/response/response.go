@@ -4,31 +4,205 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/KDT2006/go-http/internal/cookie"
 	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
 )
 
 type StatusCode int
 type WriterState int
 
 const (
-	OK = iota
-	BadRequest
-	InternalServerErrror
+	Continue           StatusCode = 100
+	SwitchingProtocols StatusCode = 101
+	EarlyHints         StatusCode = 103
+
+	OK             StatusCode = 200
+	Created        StatusCode = 201
+	Accepted       StatusCode = 202
+	NoContent      StatusCode = 204
+	PartialContent StatusCode = 206
+
+	MovedPermanently  StatusCode = 301
+	Found             StatusCode = 302
+	SeeOther          StatusCode = 303
+	NotModified       StatusCode = 304
+	TemporaryRedirect StatusCode = 307
+	PermanentRedirect StatusCode = 308
+
+	BadRequest           StatusCode = 400
+	Unauthorized         StatusCode = 401
+	Forbidden            StatusCode = 403
+	NotFound             StatusCode = 404
+	MethodNotAllowed     StatusCode = 405
+	NotAcceptable        StatusCode = 406
+	ProxyAuthRequired    StatusCode = 407
+	RequestTimeout       StatusCode = 408
+	LengthRequired       StatusCode = 411
+	PreconditionFailed   StatusCode = 412
+	ContentTooLarge      StatusCode = 413
+	UnsupportedMediaType StatusCode = 415
+	RangeNotSatisfiable  StatusCode = 416
+	ExpectationFailed    StatusCode = 417
+
+	InternalServerErrror StatusCode = 500
+	NotImplemented       StatusCode = 501
+	BadGateway           StatusCode = 502
+	ServiceUnavailable   StatusCode = 503
+	GatewayTimeout       StatusCode = 504
 )
 
+var statusText = map[StatusCode]string{
+	Continue:           "Continue",
+	SwitchingProtocols: "Switching Protocols",
+	EarlyHints:         "Early Hints",
+
+	OK:             "OK",
+	Created:        "Created",
+	Accepted:       "Accepted",
+	NoContent:      "No Content",
+	PartialContent: "Partial Content",
+
+	MovedPermanently:  "Moved Permanently",
+	Found:             "Found",
+	SeeOther:          "See Other",
+	NotModified:       "Not Modified",
+	TemporaryRedirect: "Temporary Redirect",
+	PermanentRedirect: "Permanent Redirect",
+
+	BadRequest:           "Bad Request",
+	Unauthorized:         "Unauthorized",
+	Forbidden:            "Forbidden",
+	NotFound:             "Not Found",
+	MethodNotAllowed:     "Method Not Allowed",
+	NotAcceptable:        "Not Acceptable",
+	ProxyAuthRequired:    "Proxy Authentication Required",
+	RequestTimeout:       "Request Timeout",
+	LengthRequired:       "Length Required",
+	PreconditionFailed:   "Precondition Failed",
+	ContentTooLarge:      "Content Too Large",
+	UnsupportedMediaType: "Unsupported Media Type",
+	RangeNotSatisfiable:  "Range Not Satisfiable",
+	ExpectationFailed:    "Expectation Failed",
+
+	InternalServerErrror: "Internal Server Error",
+	NotImplemented:       "Not Implemented",
+	BadGateway:           "Bad Gateway",
+	ServiceUnavailable:   "Service Unavailable",
+	GatewayTimeout:       "Gateway Timeout",
+}
+
+// StatusText returns the reason phrase for code, or "" if it's unknown.
+func StatusText(code StatusCode) string {
+	return statusText[code]
+}
+
+// A Writer moves from StatusLine to Headers to Body for the final response.
+// Informational (1xx) responses sent through WriteInformational leave it in StatusLine.
 const (
 	StatusLine = iota
 	Headers
 	Body
 )
 
+// bufferLimit is how much of the body Write holds back before committing
+// the headers. Bodies that fit are sent with a Content-Length, larger ones chunked.
+const bufferLimit = 4096
+
+// sniffLen is how many body bytes are used for Content-Type sniffing.
+const sniffLen = 512
+
 type Writer struct {
 	Conn        io.Writer
 	Headers     headers.Headers
 	Status      StatusCode
 	Body        []byte
 	WriterState WriterState
+
+	// Set-Cookie lines, kept apart from Headers since they
+	// can't be combined into a single comma separated value
+	cookies []string
+	// cookieKeys identify the cookie of each line set through SetCookie
+	cookieKeys []string
+
+	// Body bytes written through Write before the headers were committed
+	pending []byte
+	// chunked is set once the headers announced Transfer-Encoding: chunked
+	chunked bool
+	// chunksDone and finished track the terminating chunk and final CRLF
+	chunksDone bool
+	finished   bool
+
+	// trailersAccepted is set when the client sent "TE: trailers"
+	trailersAccepted bool
+	// isHead is set for responses to HEAD requests, see IsHead
+	isHead bool
+	// isConnect is set for responses to CONNECT requests, a 2xx turns the connection into a tunnel
+	isConnect bool
+	// headLength counts the body bytes discarded for a HEAD response
+	headLength int
+	// Trailer names announced through DeclareTrailer and their values
+	declaredTrailers []string
+	trailers         headers.Headers
+
+	// hijacked is set once the handler took over the connection
+	hijacked bool
+	// bodyBytes counts the body bytes sent, after encoding and without chunk framing
+	bodyBytes int64
+
+	// bodyEncoder and encoder transform the body, see SetBodyEncoder
+	bodyEncoder BodyEncoder
+	encoder     io.WriteCloser
+	// errorWriter writes the error responses of this package, see SetErrorWriter
+	errorWriter ErrorWriter
+}
+
+// BodyEncoder is called once when the headers are about to be committed, with
+// the full body length if known (-1 otherwise) and the writer for the framed body.
+// It may adjust w.Headers and returns a writer that encodes the body into dst,
+// or nil to leave the body untouched. HEAD and 304 responses call it too, so their
+// headers match the full response, the returned writer is then closed unused.
+type BodyEncoder func(w *Writer, contentLength int, dst io.Writer) io.WriteCloser
+
+// ErrorWriter replaces the response in w with an error response for code,
+// adding the headers in h (e.g. Content-Range for a 416).
+type ErrorWriter func(w *Writer, code StatusCode, h headers.Headers)
+
+// bodyWriter writes already encoded body bytes with the response's framing.
+type bodyWriter struct {
+	w *Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.writeFramed(p)
+}
+
+// NewWriter creates a Writer for the response to req, sent over conn.
+func NewWriter(conn io.Writer, req *request.Request) *Writer {
+	w := &Writer{
+		Conn:        conn,
+		WriterState: StatusLine,
+	}
+
+	if req != nil {
+		w.isHead = req.IsHead()
+		w.isConnect = req.RequestLine.Method == "CONNECT"
+		for _, te := range strings.Split(req.Headers.Get("TE"), ",") {
+			name, _, _ := strings.Cut(te, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "trailers") {
+				w.trailersAccepted = true
+			}
+		}
+	}
+
+	return w
 }
 
 func (w *Writer) WriteStatusLine() error {
@@ -37,31 +211,62 @@ func (w *Writer) WriteStatusLine() error {
 		return fmt.Errorf("error: Improper response order, expected: Status Line -> Headers -> Body\n")
 	}
 
-	switch w.Status {
-	case OK:
-		_, err := w.Conn.Write([]byte("HTTP/1.1 200 OK\r\n"))
-		if err != nil {
-			return err
-		}
+	// The zero value of Status means OK
+	if w.Status == 0 {
+		w.Status = OK
+	}
+	if w.Status < 100 || w.Status > 999 {
+		return fmt.Errorf("error: invalid status code: %d", w.Status)
+	}
 
-	case BadRequest:
-		_, err := w.Conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
-		if err != nil {
-			return err
+	_, err := w.Conn.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", w.Status, StatusText(w.Status))))
+	if err != nil {
+		return err
+	}
+
+	w.WriterState = Headers
+
+	return nil
+}
+
+// WriteInformational sends an interim 1xx response with the given headers, e.g.
+// 103 Early Hints with "Link: </style.css>; rel=preload; as=style" so the client
+// can start fetching while the final response is prepared. It can be called any
+// number of times before the final status line, each response is flushed right away.
+func (w *Writer) WriteInformational(code StatusCode, h headers.Headers) error {
+	if w.WriterState != StatusLine {
+		return fmt.Errorf("error: WriteInformational() called after the final status line was written")
+	}
+	// 101 switches protocols and is final for the connection, it goes through WriteStatusLine
+	if code < 100 || code > 199 || code == SwitchingProtocols {
+		return fmt.Errorf("error: invalid informational status code: %d", code)
+	}
+	for key, value := range h {
+		if strings.ContainsAny(key+value, "\r\n") {
+			return fmt.Errorf("error: invalid header %q", key)
 		}
+	}
+	if w.hijacked {
+		return fmt.Errorf("error: WriteInformational() called after the connection was hijacked")
+	}
 
-	case InternalServerErrror:
-		_, err := w.Conn.Write([]byte("HTTP/1.1 500 Internal Server Error\r\n"))
+	_, err := w.Conn.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", code, StatusText(code))))
+	if err != nil {
+		return err
+	}
+	for key, value := range h {
+		_, err := w.Conn.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value)))
 		if err != nil {
 			return err
 		}
-
-	default:
-		return nil
+	}
+	if _, err := w.Conn.Write([]byte("\r\n")); err != nil {
+		return err
 	}
 
-	w.WriterState = Headers
-
+	if f, ok := w.Conn.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
 	return nil
 }
 
@@ -77,9 +282,16 @@ func (w *Writer) WriteHeaders() error {
 			return err
 		}
 	}
+	for _, c := range w.cookies {
+		_, err := w.Conn.Write([]byte(fmt.Sprintf("Set-Cookie: %s\r\n", c)))
+		if err != nil {
+			return err
+		}
+	}
 	w.Conn.Write([]byte("\r\n")) // Final CRLF to denote end of headers
 
 	w.WriterState = Body
+	w.chunked = strings.Contains(strings.ToLower(w.Headers.Get("Transfer-Encoding")), "chunked")
 
 	return nil
 }
@@ -90,7 +302,13 @@ func (w *Writer) WriteBody() (int, error) {
 		return 0, fmt.Errorf("error: Improper response order, expected: Status Line -> Headers -> Body\n")
 	}
 
-	_, err := w.Conn.Write(w.Body)
+	// Content-Length still describes w.Body, only the bytes are left out
+	if w.noBody() {
+		return 0, nil
+	}
+
+	n, err := w.Conn.Write(w.Body)
+	w.bodyBytes += int64(n)
 	if err != nil {
 		log.Println("error: WriteBody() failed:", err)
 		return 0, err
@@ -99,6 +317,42 @@ func (w *Writer) WriteBody() (int, error) {
 	return len(w.Body), nil
 }
 
+// SetCookie validates c and adds a Set-Cookie line to the response headers,
+// replacing one set earlier for the same name, domain and path.
+// It must be called before WriteHeaders.
+func (w *Writer) SetCookie(c *cookie.Cookie) error {
+	if w.WriterState == Body {
+		return fmt.Errorf("error: SetCookie() called after headers were written")
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	key := c.Name + ";" + strings.ToLower(c.Domain) + ";" + c.Path
+	if i := slices.Index(w.cookieKeys, key); i >= 0 {
+		w.cookies[i] = c.String()
+		return nil
+	}
+	w.cookies = append(w.cookies, c.String())
+	w.cookieKeys = append(w.cookieKeys, key)
+	return nil
+}
+
+// AddSetCookieLine adds an already serialized Set-Cookie value, e.g. when
+// relaying an upstream response. Prefer SetCookie, which validates the cookie.
+func (w *Writer) AddSetCookieLine(value string) error {
+	if w.WriterState == Body {
+		return fmt.Errorf("error: AddSetCookieLine() called after headers were written")
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("error: invalid Set-Cookie value")
+	}
+
+	w.cookies = append(w.cookies, value)
+	w.cookieKeys = append(w.cookieKeys, "")
+	return nil
+}
+
 func GetDefaultHeaders(contentLen int) headers.Headers {
 	headers := headers.NewHeaders()
 	headers["Content-Length"] = fmt.Sprint(contentLen)
@@ -109,6 +363,15 @@ func GetDefaultHeaders(contentLen int) headers.Headers {
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.WriterState != Body {
+		if err := w.commit(-1); err != nil {
+			return 0, err
+		}
+	}
+	if w.noBody() {
+		return len(p), nil
+	}
+
 	// End of chunks
 	if len(p) == 0 {
 		n, err := w.WriteChunkedBodyDone()
@@ -128,7 +391,11 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	}
 
 	// Write the content
-	_, err = w.Conn.Write(p)
+	n, err := w.Conn.Write(p)
+	w.bodyBytes += int64(n)
+	if err != nil {
+		return 0, err
+	}
 	_, err = w.Conn.Write([]byte("\r\n"))
 	if err != nil {
 		return 0, err
@@ -138,6 +405,20 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.WriterState != Body {
+		if err := w.commit(-1); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := w.closeEncoder(); err != nil {
+		return 0, err
+	}
+	if w.noBody() {
+		w.chunksDone = true
+		return 0, nil
+	}
+
 	// Write 0 and CRLF
 	zeroHex := fmt.Sprintf("%x", 0)
 	_, err := w.Conn.Write([]byte(zeroHex))
@@ -149,11 +430,23 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	w.chunksDone = true
 
 	return 0, nil
 }
 
 func (w *Writer) WriteTrailers(h headers.Headers) error {
+	if w.noBody() {
+		w.finished = true
+		return nil
+	}
+
+	for key := range h {
+		if headers.IsForbiddenTrailer(key) {
+			return fmt.Errorf("error: %q is not allowed in trailers", key)
+		}
+	}
+
 	// Write the headers with \r\n
 	for key, value := range h {
 		_, err := w.Conn.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value)))
@@ -165,5 +458,366 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 
 	// Last CRLF for signalling the end
 	_, err := w.Conn.Write([]byte("\r\n"))
+	w.finished = true
+	return err
+}
+
+// DeclareTrailer announces trailer fields in the Trailer header. It must be
+// called before the headers are committed and forces a chunked body. Trailers
+// are only sent to clients that sent "TE: trailers", otherwise they're dropped.
+func (w *Writer) DeclareTrailer(names ...string) error {
+	if w.WriterState == Body {
+		return fmt.Errorf("error: DeclareTrailer() called after headers were written")
+	}
+
+	for _, name := range names {
+		if headers.IsForbiddenTrailer(name) {
+			return fmt.Errorf("error: %q is not allowed in trailers", name)
+		}
+		if !slices.ContainsFunc(w.declaredTrailers, func(d string) bool { return strings.EqualFold(d, name) }) {
+			w.declaredTrailers = append(w.declaredTrailers, name)
+		}
+	}
+
+	return nil
+}
+
+// SetTrailer sets the value of a trailer declared through DeclareTrailer.
+// It can be called at any point while the body is being written.
+func (w *Writer) SetTrailer(name string, value string) error {
+	i := slices.IndexFunc(w.declaredTrailers, func(d string) bool { return strings.EqualFold(d, name) })
+	if i == -1 {
+		return fmt.Errorf("error: trailer %q was not declared", name)
+	}
+	if w.finished {
+		return fmt.Errorf("error: SetTrailer() called after the response was completed")
+	}
+
+	if w.trailers == nil {
+		w.trailers = headers.NewHeaders()
+	}
+	w.trailers.Set(w.declaredTrailers[i], value) // Keep the declared casing
+	return nil
+}
+
+// Write writes p as part of the response body. The status line and headers
+// are sent implicitly on the first write that doesn't fit the internal buffer,
+// or by Close. Once committed, the body is chunked unless a Content-Length was known.
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// HEAD responses count the body for Content-Length but never send it,
+	// keeping just enough for Content-Type sniffing
+	if w.isHead {
+		if w.WriterState != Body {
+			w.headLength += len(p)
+			if len(w.pending) < sniffLen {
+				w.pending = append(w.pending, p[:min(len(p), sniffLen-len(w.pending))]...)
+			}
+		}
+		return len(p), nil
+	}
+
+	if w.WriterState != Body {
+		w.pending = append(w.pending, p...)
+
+		// A handler supplied length or chunked framing lets us stream right away
+		if len(w.pending) <= bufferLimit && !w.forceChunked() && w.Headers.Get("Content-Length") == "" {
+			return len(p), nil
+		}
+
+		if err := w.commit(-1); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.writeFramed(p)
+}
+
+func (w *Writer) writeFramed(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.noBody() {
+		return len(p), nil // Discard bodies of 1xx, 204 and 304 responses
+	}
+	if w.chunked {
+		return w.WriteChunkedBody(p)
+	}
+	n, err := w.Conn.Write(p)
+	w.bodyBytes += int64(n)
+	return n, err
+}
+
+// Hijack lets the handler take over the connection, e.g. after a 101 Switching
+// Protocols response. Anything written so far is flushed first, and the writer
+// must not be used afterwards. The server still closes the connection once the
+// handler returns.
+func (w *Writer) Hijack() (net.Conn, error) {
+	h, ok := w.Conn.(interface{ Hijack() (net.Conn, error) })
+	if !ok {
+		return nil, fmt.Errorf("error: connection doesn't support hijacking")
+	}
+
+	if w.WriterState == Body {
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := h.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	w.hijacked = true
+	return conn, nil
+}
+
+// closeEncoder flushes whatever the body encoder still holds before the body is terminated.
+func (w *Writer) closeEncoder() error {
+	if w.encoder == nil {
+		return nil
+	}
+	encoder := w.encoder
+	w.encoder = nil
+	return encoder.Close()
+}
+
+// SetBodyEncoder installs fn to transform the body, e.g. for compression.
+// It must be called before the headers are committed.
+func (w *Writer) SetBodyEncoder(fn BodyEncoder) error {
+	if w.WriterState == Body {
+		return fmt.Errorf("error: SetBodyEncoder() called after headers were written")
+	}
+	w.bodyEncoder = fn
+	return nil
+}
+
+// SetErrorWriter installs fn to write the error responses sent by this package
+// (412 and 416), the server uses it to render them like handler errors.
+func (w *Writer) SetErrorWriter(fn ErrorWriter) {
+	w.errorWriter = fn
+}
+
+// writeError replaces the response with an error response for code, written
+// by the ErrorWriter if there's one and as plain text otherwise.
+func (w *Writer) writeError(code StatusCode, h headers.Headers) error {
+	if w.errorWriter != nil {
+		w.errorWriter(w, code, h)
+		return nil
+	}
+
+	if err := w.Reset(); err != nil {
+		return err
+	}
+	for key, value := range h {
+		w.Headers.Set(key, value)
+	}
+	w.Headers.Set("Content-Type", "text/plain; charset=utf-8")
+	w.Status = code
+	_, err := fmt.Fprintf(w, "%d %s\n", code, StatusText(code))
+	return err
+}
+
+// Flush commits the headers if needed and sends any buffered body bytes,
+// flushing the underlying connection if it supports it.
+func (w *Writer) Flush() error {
+	if w.WriterState != Body {
+		if err := w.commit(-1); err != nil {
+			return err
+		}
+	}
+
+	if f, ok := w.Conn.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close completes the response: if nothing was committed yet the buffered body
+// is sent with a Content-Length, otherwise a chunked body is terminated.
+func (w *Writer) Close() error {
+	if w.hijacked {
+		return nil
+	}
+
+	if w.WriterState != Body {
+		contentLength := len(w.pending)
+		if w.isHead {
+			contentLength = w.headLength
+		}
+		if err := w.commit(contentLength); err != nil {
+			return err
+		}
+	}
+
+	if err := w.closeEncoder(); err != nil {
+		return err
+	}
+
+	if w.chunked && !w.finished {
+		if !w.chunksDone {
+			if _, err := w.WriteChunkedBodyDone(); err != nil {
+				return err
+			}
+		}
+		var trailers headers.Headers
+		if w.trailersAccepted {
+			trailers = w.trailers
+		}
+		if err := w.WriteTrailers(trailers); err != nil {
+			return err
+		}
+	}
+	w.finished = true
+
+	if f, ok := w.Conn.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Committed reports whether the status line was sent or the connection hijacked,
+// after which the response can no longer be changed.
+func (w *Writer) Committed() bool {
+	return w.WriterState != StatusLine || w.hijacked
+}
+
+// Reset discards the status, headers, cookies, trailers and buffered body set so far,
+// e.g. to send an error response instead. The body encoder is kept.
+func (w *Writer) Reset() error {
+	if w.Committed() {
+		return fmt.Errorf("error: Reset() called after the response was committed")
+	}
+
+	w.Status = 0
+	w.Headers = headers.NewHeaders()
+	w.Body = nil
+	w.cookies = nil
+	w.cookieKeys = nil
+	w.pending = nil
+	w.headLength = 0
+	w.declaredTrailers = nil
+	w.trailers = nil
+	return nil
+}
+
+// BytesWritten returns the number of body bytes sent so far, e.g. for access logs.
+// Encoded bodies count their encoded size, chunk framing isn't counted.
+func (w *Writer) BytesWritten() int64 {
+	return w.bodyBytes
+}
+
+// IsHead reports whether the response is for a HEAD request. The writer discards
+// the body of such responses, handlers may use this to skip producing it.
+func (w *Writer) IsHead() bool {
+	return w.isHead
+}
+
+// noBody reports whether body bytes must be left out of the response.
+func (w *Writer) noBody() bool {
+	return w.isHead || !bodyAllowed(w.Status) || w.tunnel()
+}
+
+// tunnel reports whether the response establishes a CONNECT tunnel,
+// which has no body and is followed by the tunneled bytes (RFC 9110 Section 9.3.6).
+func (w *Writer) tunnel() bool {
+	return w.isConnect && w.Status >= 200 && w.Status < 300
+}
+
+// bodyAllowed reports whether a response with the given status may have a body.
+func bodyAllowed(status StatusCode) bool {
+	return !(status >= 100 && status < 200) && status != NoContent && status != NotModified
+}
+
+// forceChunked reports whether the handler asked for chunked framing,
+// either directly or by announcing trailers.
+func (w *Writer) forceChunked() bool {
+	return strings.Contains(strings.ToLower(w.Headers.Get("Transfer-Encoding")), "chunked") ||
+		w.Headers.Get("Trailer") != "" ||
+		(w.trailersAccepted && len(w.declaredTrailers) > 0)
+}
+
+// commit sends the status line and headers, filling in framing and default headers,
+// then writes out the pending body. contentLength is -1 if the full body isn't known.
+func (w *Writer) commit(contentLength int) error {
+	if w.Headers == nil {
+		w.Headers = headers.NewHeaders()
+	}
+
+	if w.WriterState == StatusLine {
+		if err := w.WriteStatusLine(); err != nil {
+			return err
+		}
+	}
+
+	if w.trailersAccepted && len(w.declaredTrailers) > 0 {
+		w.Headers.Set("Trailer", strings.Join(w.declaredTrailers, ", "))
+	}
+	if w.Headers.Get("Date") == "" {
+		w.Headers.Set("Date", time.Now().UTC().Format(headers.TimeFormat))
+	}
+	if w.Headers.Get("Connection") == "" && !w.tunnel() {
+		// The server closes the connection after every response
+		w.Headers.Set("Connection", "close")
+	}
+	if w.Headers.Get("Content-Type") == "" && len(w.pending) > 0 && bodyAllowed(w.Status) && !w.tunnel() {
+		w.Headers.Set("Content-Type", http.DetectContentType(w.pending))
+	}
+
+	if w.bodyEncoder != nil && (bodyAllowed(w.Status) || w.Status == NotModified) && !w.tunnel() {
+		var dst io.Writer = bodyWriter{w}
+		if w.noBody() {
+			dst = io.Discard
+		}
+		if encoder := w.bodyEncoder(w, contentLength, dst); encoder != nil {
+			// The encoded length isn't known up front
+			w.Headers.Del("Content-Length")
+			contentLength = -1
+			if w.noBody() {
+				// Only the headers of HEAD and 304 responses reflect the encoding
+				encoder.Close()
+			} else {
+				w.encoder = encoder
+			}
+		}
+	}
+
+	switch {
+	case !bodyAllowed(w.Status) || w.tunnel():
+		// 1xx, 204, 304 and tunnel responses never have a body or framing headers
+		w.Headers.Del("Transfer-Encoding")
+		w.Headers.Del("Content-Length")
+		if w.Status == NotModified {
+			// Kept until now so the body encoder could decide as for the full response
+			w.Headers.Del("Content-Type")
+		}
+	case w.forceChunked():
+		w.Headers.Del("Content-Length")
+		w.Headers.Set("Transfer-Encoding", "chunked")
+	case w.Headers.Get("Content-Length") != "":
+		// Handler supplied length wins
+	case contentLength >= 0:
+		w.Headers.Set("Content-Length", strconv.Itoa(contentLength))
+	default:
+		w.Headers.Set("Transfer-Encoding", "chunked")
+	}
+
+	if err := w.WriteHeaders(); err != nil {
+		return err
+	}
+
+	pending := w.pending
+	w.pending = nil
+	if len(pending) == 0 || w.noBody() {
+		return nil
+	}
+	_, err := w.Write(pending)
 	return err
 }
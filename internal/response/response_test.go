@@ -0,0 +1,205 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/KDT2006/go-http/internal/cookie"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWriter(t *testing.T, method string) (*Writer, *bytes.Buffer) {
+	req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	return NewWriter(buf, req), buf
+}
+
+func TestWriteFraming(t *testing.T) {
+	// Test: Small bodies get a Content-Length
+	w, buf := newTestWriter(t, "GET")
+	w.Write([]byte("hello"))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Test: Large bodies are chunked
+	w, buf = newTestWriter(t, "GET")
+	w.Write([]byte(strings.Repeat("a", bufferLimit+1)))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n0\r\n\r\n"))
+
+	// Test: Status and headers are filled in implicitly
+	w, buf = newTestWriter(t, "GET")
+	w.Write([]byte("hello"))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, buf.String(), "Connection: close\r\n")
+	assert.Contains(t, buf.String(), "Date: ")
+
+	// Test: Empty bodies
+	w, buf = newTestWriter(t, "GET")
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "Content-Length: 0\r\n")
+	assert.NotContains(t, buf.String(), "Content-Type")
+
+	// Test: A handler supplied Content-Length is streamed without buffering
+	w, buf = newTestWriter(t, "GET")
+	w.Headers = headers.NewHeaders()
+	w.Headers.Set("Content-Length", "10")
+	w.Write([]byte("hello"))
+	assert.True(t, w.Committed())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+	w.Write([]byte("world"))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "Content-Length: 10\r\n")
+	assert.NotContains(t, buf.String(), "Transfer-Encoding")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhelloworld"))
+
+	// Test: A handler supplied Transfer-Encoding streams chunks
+	w, buf = newTestWriter(t, "GET")
+	w.Headers = headers.NewHeaders()
+	w.Headers.Set("Transfer-Encoding", "chunked")
+	w.Write([]byte("hello"))
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n5\r\nhello\r\n"))
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "Content-Length")
+	assert.True(t, strings.HasSuffix(buf.String(), "5\r\nhello\r\n0\r\n\r\n"))
+
+	// Test: Flush commits the headers, the rest of the body is chunked
+	w, buf = newTestWriter(t, "GET")
+	w.Write([]byte("a"))
+	require.NoError(t, w.Flush())
+	assert.True(t, w.Committed())
+	assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n1\r\na\r\n"))
+	w.Write([]byte("bc"))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n1\r\na\r\n2\r\nbc\r\n0\r\n\r\n"))
+
+	// Test: Close only terminates the body once
+	require.NoError(t, w.Close())
+	assert.Equal(t, 1, strings.Count(buf.String(), "0\r\n\r\n"))
+}
+
+func TestTrailers(t *testing.T) {
+	newWriter := func(te string) (*Writer, *bytes.Buffer) {
+		req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n" + te + "\r\n"))
+		require.NoError(t, err)
+		buf := new(bytes.Buffer)
+		return NewWriter(buf, req), buf
+	}
+
+	// Test: Declared trailers follow the chunked body
+	w, buf := newWriter("TE: trailers\r\n")
+	require.NoError(t, w.DeclareTrailer("X-Checksum", "X-Count"))
+	w.Write([]byte("hello"))
+	require.NoError(t, w.SetTrailer("x-checksum", "abc"))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "Trailer: X-Checksum, X-Count\r\n")
+	assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n5\r\nhello\r\n0\r\nX-Checksum: abc\r\n\r\n"))
+
+	// Test: Forbidden and undeclared trailers are rejected
+	w, _ = newWriter("TE: trailers\r\n")
+	assert.Error(t, w.DeclareTrailer("Content-Length"))
+	assert.Error(t, w.DeclareTrailer("X-Ok", "Authorization"))
+	assert.Error(t, w.SetTrailer("X-Other", "1"))
+	forbidden := headers.NewHeaders()
+	forbidden.Set("Host", "example.com")
+	assert.Error(t, w.WriteTrailers(forbidden))
+
+	// Test: Trailers are dropped for clients that didn't send "TE: trailers"
+	w, buf = newWriter("")
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	w.Write([]byte("hello"))
+	require.NoError(t, w.SetTrailer("X-Checksum", "abc"))
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "Trailer")
+	assert.NotContains(t, buf.String(), "X-Checksum")
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Test: Declaring after the headers were sent
+	w, _ = newWriter("TE: trailers\r\n")
+	require.NoError(t, w.Flush())
+	assert.Error(t, w.DeclareTrailer("X-Checksum"))
+}
+
+func TestHeadResponses(t *testing.T) {
+	// Test: Implicit writes keep the GET Content-Length
+	w, buf := newTestWriter(t, "HEAD")
+	assert.True(t, w.IsHead())
+	w.Write([]byte(strings.Repeat("<p>x</p>", 1000)))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "Content-Length: 8000\r\n")
+	assert.Contains(t, buf.String(), "Content-Type: text/html; charset=utf-8\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+
+	// Test: Explicit WriteBody
+	w, buf = newTestWriter(t, "HEAD")
+	w.Body = []byte("hello")
+	w.Headers = GetDefaultHeaders(len(w.Body))
+	require.NoError(t, w.WriteStatusLine())
+	require.NoError(t, w.WriteHeaders())
+	_, err := w.WriteBody()
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+}
+
+func TestBodylessStatuses(t *testing.T) {
+	for _, status := range []StatusCode{NoContent, NotModified} {
+		w, buf := newTestWriter(t, "GET")
+		w.Status = status
+		w.Write([]byte("ignored"))
+		require.NoError(t, w.Close())
+		assert.NotContains(t, buf.String(), "Content-Length")
+		assert.NotContains(t, buf.String(), "Content-Type")
+		assert.NotContains(t, buf.String(), "ignored")
+	}
+}
+
+func TestInformationalResponses(t *testing.T) {
+	// Test: Early hints precede the final response
+	w, buf := newTestWriter(t, "GET")
+	hints := headers.NewHeaders()
+	hints.Set("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteInformational(EarlyHints, hints))
+	require.NoError(t, w.WriteInformational(EarlyHints, hints))
+	w.Write([]byte("hello"))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n\r\nHTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Test: Not allowed after the final status line, or with a non 1xx status
+	assert.Error(t, w.WriteInformational(EarlyHints, nil))
+	w, _ = newTestWriter(t, "GET")
+	assert.Error(t, w.WriteInformational(SwitchingProtocols, nil))
+	assert.Error(t, w.WriteInformational(OK, nil))
+}
+
+func TestSetCookie(t *testing.T) {
+	// Test: Setting a cookie again replaces it, other paths and raw lines are kept
+	w, buf := newTestWriter(t, "GET")
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "1", Path: "/"}))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "1", Path: "/admin"}))
+	require.NoError(t, w.AddSetCookieLine("a=raw"))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "2", Path: "/"}))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "Set-Cookie: a=2; Path=/\r\nSet-Cookie: a=1; Path=/admin\r\nSet-Cookie: a=raw\r\n")
+	assert.NotContains(t, buf.String(), "a=1; Path=/\r\n")
+
+	// Test: Invalid cookies are refused
+	w, _ = newTestWriter(t, "GET")
+	assert.Error(t, w.SetCookie(&cookie.Cookie{Name: "bad name", Value: "1"}))
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+// HandleError is returned by handlers to have the server send an error response.
+// Any other error returned by a handler is sent as a 500 Internal Server Error.
+type HandleError struct {
+	// StatusCode defaults to 500
+	StatusCode response.StatusCode
+	// Message is shown to the client, defaults to the status' reason phrase
+	Message string
+	// Headers are added to the response, e.g. Allow for a 405
+	Headers headers.Headers
+	// Err is the underlying cause, it's only logged
+	Err error
+}
+
+func (e *HandleError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.status(), e.message())
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HandleError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HandleError) status() response.StatusCode {
+	if e.StatusCode == 0 {
+		return response.InternalServerErrror
+	}
+	return e.StatusCode
+}
+
+func (e *HandleError) message() string {
+	if e.Message == "" {
+		return response.StatusText(e.status())
+	}
+	return e.Message
+}
+
+// ErrorRenderer writes error responses in one media type.
+type ErrorRenderer struct {
+	// ContentType is sent as the Content-Type and matched against the Accept header
+	ContentType string
+	// Render writes the body for e, the status and headers are already set on w
+	Render func(w io.Writer, req *request.Request, e *HandleError) error
+}
+
+var (
+	// TextErrorRenderer writes the status line followed by the message.
+	TextErrorRenderer = ErrorRenderer{
+		ContentType: "text/plain; charset=utf-8",
+		Render: func(w io.Writer, req *request.Request, e *HandleError) error {
+			status := e.status()
+			body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+			if e.Message != "" {
+				body += e.Message + "\n"
+			}
+			_, err := io.WriteString(w, body)
+			return err
+		},
+	}
+
+	// HTMLErrorRenderer writes a minimal HTML page.
+	HTMLErrorRenderer = ErrorRenderer{
+		ContentType: "text/html; charset=utf-8",
+		Render: func(w io.Writer, req *request.Request, e *HandleError) error {
+			status := e.status()
+			title := html.EscapeString(fmt.Sprintf("%d %s", status, response.StatusText(status)))
+			_, err := fmt.Fprintf(w, `<html>
+  <head>
+    <title>%s</title>
+  </head>
+  <body>
+    <h1>%s</h1>
+    <p>%s</p>
+  </body>
+</html>
+`, title, html.EscapeString(response.StatusText(status)), html.EscapeString(e.message()))
+			return err
+		},
+	}
+
+	// ProblemErrorRenderer writes a Problem Details object (RFC 9457).
+	ProblemErrorRenderer = ErrorRenderer{
+		ContentType: "application/problem+json",
+		Render: func(w io.Writer, req *request.Request, e *HandleError) error {
+			problem := struct {
+				Type   string `json:"type"`
+				Title  string `json:"title"`
+				Status int    `json:"status"`
+				Detail string `json:"detail,omitempty"`
+			}{
+				Type:   "about:blank",
+				Title:  response.StatusText(e.status()),
+				Status: int(e.status()),
+				Detail: e.Message,
+			}
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+			return enc.Encode(problem)
+		},
+	}
+)
+
+// DefaultErrorRenderers serve plain text to clients without a preference, HTML
+// to browsers and problem+json to clients asking for JSON.
+var DefaultErrorRenderers = []ErrorRenderer{TextErrorRenderer, HTMLErrorRenderer, ProblemErrorRenderer}
+
+// parseErrorStatus is the status answering a request that failed with err
+// while being read, the client sent something wrong rather than the server failing.
+func parseErrorStatus(err error) response.StatusCode {
+	if errors.Is(err, request.ErrBodyTooLarge) {
+		return response.ContentTooLarge
+	}
+	return response.BadRequest
+}
+
+// WriteError sends the error response for a handler's err like the server does,
+// with the default renderers. It's meant for running handlers outside a server, e.g. in tests.
+func WriteError(w *response.Writer, req *request.Request, err error) {
+	if err != nil {
+		(&Server{}).handleError(w, req, err)
+	}
+}
+
+// handleError sends the error response for a handler's err if the response
+// wasn't committed yet, otherwise all that's left is logging it.
+// Handlers returning the error of reading the body send a 400 or 413.
+func (s *Server) handleError(w *response.Writer, req *request.Request, err error) {
+	var handleErr *HandleError
+	var parseErr *request.ParseError
+	switch {
+	case errors.As(err, &handleErr):
+	case errors.As(err, &parseErr):
+		handleErr = &HandleError{StatusCode: parseErrorStatus(err), Err: err}
+	default:
+		handleErr = &HandleError{Err: err}
+	}
+
+	if w.Committed() {
+		log.Println("error: handler failed after the response was committed:", err)
+		return
+	}
+	if handleErr.status() >= 500 {
+		log.Println("error: handler failed:", err)
+	}
+
+	s.renderError(w, req, handleErr)
+}
+
+// renderError replaces whatever the handler left in w with the error
+// response, rendered in the media type the client prefers.
+func (s *Server) renderError(w *response.Writer, req *request.Request, e *HandleError) {
+	renderers := s.opts.ErrorRenderers
+	if len(renderers) == 0 {
+		renderers = DefaultErrorRenderers
+	}
+
+	contentTypes := make([]string, len(renderers))
+	for i, r := range renderers {
+		contentTypes[i] = r.ContentType
+	}
+	// Clients that accept none of them still get the first, an error beats a 406
+	renderer := renderers[0]
+	if chosen := response.NegotiateContentType(req.Headers.Get("Accept"), contentTypes); chosen != "" {
+		for _, r := range renderers {
+			if r.ContentType == chosen {
+				renderer = r
+				break
+			}
+		}
+	}
+
+	if err := w.Reset(); err != nil {
+		log.Println("error: w.Reset() failed:", err)
+		return
+	}
+	w.Status = e.status()
+	for key, value := range e.Headers {
+		w.Headers.Set(key, value)
+	}
+	w.Headers.Set("Content-Type", renderer.ContentType)
+	if len(renderers) > 1 {
+		w.Headers.Set("Vary", "Accept")
+	}
+
+	if err := renderer.Render(w, req, e); err != nil {
+		log.Println("error: rendering error response failed:", err)
+	}
+}
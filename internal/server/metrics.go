@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/accesslog"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/metrics"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+)
+
+// serverMetrics instruments a Server, they're served on Options.MetricsPath.
+type serverMetrics struct {
+	activeConns  *metrics.Gauge
+	inFlight     *metrics.Gauge
+	requests     *metrics.Counter
+	duration     *metrics.Histogram
+	bytesRead    *metrics.Counter
+	bytesWritten *metrics.Counter
+	parseErrors  *metrics.Counter
+	acceptErrors *metrics.Counter
+}
+
+func newServerMetrics(r *metrics.Registry) *serverMetrics {
+	return &serverMetrics{
+		activeConns:  r.NewGauge("http_server_active_connections", "Connections currently open."),
+		inFlight:     r.NewGauge("http_server_requests_in_flight", "Requests currently being served."),
+		requests:     r.NewCounter("http_server_requests_total", "Requests served.", "method", "route", "status"),
+		duration:     r.NewHistogram("http_server_request_duration_seconds", "Time from reading the request headers to the end of the response.", nil, "method", "route"),
+		bytesRead:    r.NewCounter("http_server_read_bytes_total", "Bytes read from connections."),
+		bytesWritten: r.NewCounter("http_server_written_bytes_total", "Bytes written to connections."),
+		parseErrors:  r.NewCounter("http_server_parse_errors_total", "Requests that couldn't be read or parsed.", "kind"),
+		acceptErrors: r.NewCounter("http_server_accept_errors_total", "Failures to accept a connection."),
+	}
+}
+
+// knownMethods are the methods of RFC 9110 and RFC 5789 (PATCH).
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true,
+}
+
+// normalizeMethod returns method, or "_OTHER" for methods outside the standard
+// set. The parser accepts any method, labelling series with them would let
+// clients create series without bound.
+func normalizeMethod(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return "_OTHER"
+}
+
+// observe records a finished request.
+func (m *serverMetrics) observe(rec accesslog.Record, route string) {
+	method := normalizeMethod(rec.Method)
+	m.requests.Inc(method, route, strconv.Itoa(int(rec.Status)))
+	m.duration.Observe(rec.Duration.Seconds(), method, route)
+}
+
+// parseError counts a request that failed with err while being read.
+func (m *serverMetrics) parseError(err error) {
+	kind := "other"
+	var parseErr *request.ParseError
+	if errors.As(err, &parseErr) {
+		kind = parseErr.Kind
+	}
+	m.parseErrors.Inc(kind)
+}
+
+// route returns the label for target: the metrics path, the longest matching
+// prefix in Options.MetricsRoutes or "other", which keeps the number of series bounded.
+func (s *Server) route(target string) string {
+	path, _, _ := strings.Cut(target, "?")
+	if s.opts.MetricsPath != "" && path == s.opts.MetricsPath {
+		return path
+	}
+
+	route := "other"
+	for _, prefix := range s.opts.MetricsRoutes {
+		if strings.HasPrefix(path, prefix) && (route == "other" || len(prefix) > len(route)) {
+			route = prefix
+		}
+	}
+	return route
+}
+
+// serveMetrics answers a request for Options.MetricsPath.
+func (s *Server) serveMetrics(w *response.Writer, req *request.Request) {
+	if req.RequestLine.Method != "GET" {
+		s.renderError(w, req, &HandleError{StatusCode: response.MethodNotAllowed})
+		w.Headers.Set("Allow", "GET, HEAD")
+		return
+	}
+
+	w.Headers = headers.NewHeaders()
+	w.Headers.Set("Content-Type", metrics.ContentType)
+	w.Headers.Set("Cache-Control", "no-store")
+	if err := s.opts.Metrics.WriteText(w); err != nil {
+		s.handleError(w, req, err)
+	}
+}
+
+// countingConn counts the bytes read from and written to a connection.
+type countingConn struct {
+	net.Conn
+	m *serverMetrics
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.m.bytesRead.Add(float64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.m.bytesWritten.Add(float64(n))
+	}
+	return n, err
+}
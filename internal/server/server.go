@@ -1,38 +1,114 @@
 package server
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/KDT2006/go-http/internal/accesslog"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/metrics"
 	"github.com/KDT2006/go-http/internal/request"
 	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/tracing"
+)
+
+// Causes of a cancelled request context, see request.Request.Context.
+var (
+	ErrServerClosed       = errors.New("error: server closed")
+	ErrClientDisconnected = errors.New("error: client disconnected")
+	ErrWriteTimeout       = errors.New("error: write timeout")
 )
 
 type Server struct {
 	Listener net.Listener
 	Handler  HandlerFunc
 	closed   atomic.Bool
+
+	opts    Options
+	metrics *serverMetrics
+	// ctx is the parent of all request contexts, cancelled by Close
+	ctx    context.Context
+	cancel context.CancelCauseFunc
 }
 
-type HandleError struct {
-	StatusCode response.StatusCode
-	Message    string
+// maxRequestIDLength caps the X-Request-ID taken from clients.
+const maxRequestIDLength = 128
+
+const defaultMaxBodySize = 10 << 20
+
+type Options struct {
+	// WriteTimeout bounds the time from reading a request's headers to the end
+	// of its response, the request context is cancelled when it passes. 0 means no timeout
+	WriteTimeout time.Duration
+	// MaxBodySize caps request bodies, larger ones are answered with 413 Content Too Large.
+	// Defaults to 10 MiB, -1 means no limit
+	MaxBodySize int64
+	// AccessLog is called with a record of every request once it's been answered,
+	// e.g. with the Log method of an accesslog.Logger
+	AccessLog func(rec accesslog.Record)
+	// ErrorRenderers write the responses for errors returned by handlers, picked by
+	// the request's Accept header. Defaults to DefaultErrorRenderers
+	ErrorRenderers []ErrorRenderer
+	// Metrics is the registry the server's metrics are added to, handlers can
+	// add their own. A new one is created if nil
+	Metrics *metrics.Registry
+	// MetricsPath serves Metrics in the Prometheus text format, disabled if empty
+	MetricsPath string
+	// MetricsRoutes are the path prefixes requests are counted by, the longest
+	// matching one is used. Requests matching none are counted as "other"
+	MetricsRoutes []string
+	// PanicHook is called after a handler panicked with the recovered value and
+	// the stack trace, e.g. to report it to an error tracker
+	PanicHook func(req *request.Request, value any, stack []byte)
+	// AllowHalfClose keeps serving clients that shut down their sending side
+	// (SHUT_WR) after the request. A clean close looks the same, so then only
+	// a reset cancels the request context with ErrClientDisconnected
+	AllowHalfClose bool
+	// Tracer starts a span for every request, continuing the trace of an incoming
+	// traceparent header. The span is in the request context, so requests made
+	// with it through the client carry the trace on. Disabled if nil
+	Tracer *tracing.Tracer
 }
 
-type HandlerFunc func(w *response.Writer, req *request.Request) *HandleError
+type HandlerFunc func(w *response.Writer, req *request.Request) error
 
 func Serve(port int, handler HandlerFunc) (*Server, error) {
+	return ServeWithOptions(port, handler, Options{})
+}
+
+func ServeWithOptions(port int, handler HandlerFunc, opts Options) (*Server, error) {
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.Metrics == nil {
+		opts.Metrics = metrics.NewRegistry()
+	}
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = defaultMaxBodySize
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
 	s := &Server{
 		Listener: ln,
 		Handler:  handler,
+		opts:     opts,
+		metrics:  newServerMetrics(opts.Metrics),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 
 	go s.listen()
@@ -40,8 +116,10 @@ func Serve(port int, handler HandlerFunc) (*Server, error) {
 	return s, nil
 }
 
+// Close stops accepting connections and cancels the context of requests being served.
 func (s *Server) Close() error {
 	s.closed.Store(true)
+	s.cancel(ErrServerClosed)
 	return s.Listener.Close()
 }
 
@@ -55,6 +133,7 @@ func (s *Server) listen() {
 			}
 
 			log.Println("Error accepting new connection:", err)
+			s.metrics.acceptErrors.Inc()
 			continue
 		}
 		log.Println("New accpeted connection:", conn.RemoteAddr())
@@ -66,40 +145,262 @@ func (s *Server) listen() {
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
 
-	// Parse the request
-	parsedReq, err := request.RequestFromReader(conn)
+	s.metrics.activeConns.Inc()
+	defer s.metrics.activeConns.Dec()
+	conn = &countingConn{Conn: conn, m: s.metrics}
+
+	// Parse the request line and headers, the body is read below
+	// or by the handler when the client expects 100 Continue
+	parsedReq, err := request.HeadFromReader(conn)
 	if err != nil {
-		log.Println("error: RequestFromReader() failed parsing the request:", err)
-		s.writeError(&response.Writer{
-			Conn:        conn,
-			Status:      response.InternalServerErrror,
-			Headers:     response.GetDefaultHeaders(0),
-			WriterState: response.StatusLine,
-		})
+		log.Println("error: HeadFromReader() failed parsing the request:", err)
+		s.metrics.parseError(err)
+		status := parseErrorStatus(err)
+		s.writeParseError(conn, status)
+		if s.opts.AccessLog != nil {
+			s.opts.AccessLog(accesslog.Record{
+				Time:       time.Now(),
+				Status:     status,
+				RemoteAddr: conn.RemoteAddr().String(),
+			})
+		}
 		return
 	}
 
-	// Buffer for the handler to write to
-	buf := new(bytes.Buffer)
+	start := time.Now()
+	method := parsedReq.RequestLine.Method
+	parsedReq.RemoteAddr = conn.RemoteAddr().String()
+	parsedReq.SetMaxBodySize(max(s.opts.MaxBodySize, 0))
+	parsedReq.ID = requestID(parsedReq)
+
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	defer cancel(nil)
+	if s.opts.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout))
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, s.opts.WriteTimeout, ErrWriteTimeout)
+		defer cancelTimeout()
+	}
+	var span *tracing.Span
+	if s.opts.Tracer != nil {
+		ctx, span = s.opts.Tracer.Start(ctx, method, tracing.SpanKindServer, tracing.Extract(parsedReq.Headers))
+	}
+	parsedReq = parsedReq.WithContext(ctx)
+
+	// Buffer writes to the connection, the response writer decides
+	// when to flush (e.g. for streamed chunked bodies)
+	buf := &connWriter{Writer: bufio.NewWriter(conn), conn: conn, stopWatch: func() {}}
 
 	// Call the handler and process the error if there's any
-	responseWriter := &response.Writer{
-		Conn:        buf,
-		WriterState: response.StatusLine,
+	responseWriter := response.NewWriter(buf, parsedReq)
+	responseWriter.SetErrorWriter(func(w *response.Writer, code response.StatusCode, h headers.Headers) {
+		s.renderError(w, parsedReq, &HandleError{StatusCode: code, Headers: h})
+	})
+
+	s.metrics.inFlight.Inc()
+	defer func() {
+		s.metrics.inFlight.Dec()
+		rec := accessRecord(parsedReq, method, responseWriter, start)
+		route := s.route(rec.Target)
+		s.metrics.observe(rec, route)
+		finishSpan(span, rec, route)
+		if s.opts.AccessLog != nil {
+			s.opts.AccessLog(rec)
+		}
+	}()
+
+	switch {
+	case parsedReq.ExpectsContinue():
+		// Only ask for the body once the handler wants it, handlers can
+		// reject it based on the headers (e.g. 413) without it ever being sent
+		// Since the handler reads the body, disconnects are watched for once it has
+		parsedReq.OnBodyRead(func() error {
+			if responseWriter.WriterState != response.StatusLine {
+				return nil // The final response is already underway
+			}
+			return responseWriter.WriteInformational(response.Continue, nil)
+		})
+		parsedReq.OnBodyDone(func() {
+			buf.stopWatch = watchDisconnect(conn, cancel, s.opts.AllowHalfClose)
+		})
+		defer func() { buf.stopWatch() }()
+	case parsedReq.Headers.Get("Expect") != "":
+		// 100-continue is the only expectation defined (RFC 9110 Section 10.1.1)
+		s.renderError(responseWriter, parsedReq, &HandleError{StatusCode: response.ExpectationFailed})
+		if err := responseWriter.Close(); err != nil {
+			log.Println("error: responseWriter.Close() failed:", err)
+		}
+		return
+	default:
+		_, err = parsedReq.ReadBody()
+		if err != nil {
+			log.Println("error: ReadBody() failed parsing the request:", err)
+			s.metrics.parseError(err)
+			s.renderError(responseWriter, parsedReq, &HandleError{StatusCode: parseErrorStatus(err)})
+			if err := responseWriter.Close(); err != nil {
+				log.Println("error: responseWriter.Close() failed:", err)
+			}
+			return
+		}
+
+		// The request is complete, anything the client does now is hanging up.
+		// Upgrades and tunnels are left alone since their client may send early
+		if parsedReq.RequestLine.Method != "CONNECT" && parsedReq.Headers.Get("Upgrade") == "" {
+			buf.stopWatch = watchDisconnect(conn, cancel, s.opts.AllowHalfClose)
+			defer buf.stopWatch()
+		}
 	}
-	handlerErr := s.Handler(responseWriter, parsedReq)
-	if handlerErr != nil {
-		s.writeError(responseWriter)
+
+	// HEAD is served by the GET handler, the writer knows
+	// it's a HEAD response and discards the body
+	parsedReq.ServeAsGet()
+
+	if s.opts.MetricsPath != "" && s.route(parsedReq.RequestLine.RequestTarget) == s.opts.MetricsPath {
+		s.serveMetrics(responseWriter, parsedReq)
+	} else if !s.callHandler(responseWriter, parsedReq) {
+		// A partial response mustn't look complete, the client
+		// only learns about the failure from the connection closing
+		return
 	}
 
-	// Write to connection regardless of error
-	// as everything will be written to buf
-	_, err = conn.Write(buf.Bytes())
+	// Complete the response, sending anything the handler
+	// wrote through Write but didn't commit
+	err = responseWriter.Close()
 	if err != nil {
-		log.Println("error: conn.Write() failed:", err)
+		log.Println("error: responseWriter.Close() failed:", err)
 	}
 }
 
+// callHandler runs the handler and sends the response for a returned error.
+// A panic is recovered and answered with a 500 if nothing was committed yet,
+// callHandler then reports whether the response can still be completed.
+func (s *Server) callHandler(w *response.Writer, req *request.Request) (ok bool) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+
+		stack := debug.Stack()
+		log.Printf("error: panic serving %s %s for %s: %v\n%s",
+			req.RequestLine.Method, req.RequestLine.RequestTarget, req.RemoteAddr, value, stack)
+		if s.opts.PanicHook != nil {
+			s.opts.PanicHook(req, value, stack)
+		}
+
+		if w.Committed() {
+			ok = false
+			return
+		}
+		s.renderError(w, req, &HandleError{StatusCode: response.InternalServerErrror})
+		ok = true
+	}()
+
+	err := s.Handler(w, req)
+	if err != nil {
+		s.handleError(w, req, err)
+	}
+	return true
+}
+
+// requestID returns the client's X-Request-ID if it's usable in logs, otherwise a random one.
+func requestID(req *request.Request) string {
+	id := req.Headers.Get("X-Request-ID")
+	if id != "" && len(id) <= maxRequestIDLength && !strings.ContainsFunc(id, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || r == '"' || r == '\\'
+	}) {
+		return id
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// accessRecord describes the finished exchange for the access log.
+// method is the request's original method, HEAD is served as GET.
+func accessRecord(req *request.Request, method string, w *response.Writer, start time.Time) accesslog.Record {
+	return accesslog.Record{
+		Time:       start,
+		Method:     method,
+		Target:     req.RequestLine.RequestTarget,
+		Proto:      "HTTP/" + req.RequestLine.HttpVersion,
+		Status:     w.Status,
+		RemoteAddr: req.RemoteAddr,
+		User:       accesslog.BasicAuthUser(req.Headers.Get("Authorization")),
+		UserAgent:  req.Headers.Get("User-Agent"),
+		Referer:    req.Headers.Get("Referer"),
+		RequestID:  req.ID,
+		BytesIn:    int64(len(req.Body)),
+		BytesOut:   w.BytesWritten(),
+		Duration:   time.Since(start),
+	}
+}
+
+// connWriter buffers writes to a connection and lets handlers take it over.
+type connWriter struct {
+	*bufio.Writer
+	conn net.Conn
+	// stopWatch stops watching the connection for a disconnect, see watchDisconnect
+	stopWatch func()
+}
+
+// Hijack flushes buffered writes and hands out the underlying connection,
+// without the write timeout.
+func (c *connWriter) Hijack() (net.Conn, error) {
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	c.stopWatch()
+	c.conn.SetWriteDeadline(time.Time{})
+	return c.conn, nil
+}
+
+// watchDisconnect reads from conn in the background and cancels the request
+// context once the client closes it. Bytes read are discarded, the connection
+// is closed after the response anyway. With halfClose io.EOF only stops
+// watching, see Options.AllowHalfClose. The returned function stops watching,
+// it must be called before anything else reads from conn.
+func watchDisconnect(conn net.Conn, cancel context.CancelCauseFunc, halfClose bool) func() {
+	var stopping atomic.Bool
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		tmpBuf := make([]byte, 1)
+		for {
+			_, err := conn.Read(tmpBuf)
+			if err == io.EOF && halfClose {
+				return
+			}
+			if err != nil {
+				if !stopping.Load() {
+					cancel(ErrClientDisconnected)
+				}
+				return
+			}
+		}
+	}()
+
+	return sync.OnceFunc(func() {
+		// Unblock the pending read
+		stopping.Store(true)
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	})
+}
+
+// writeParseError answers a request that couldn't be parsed with status.
+func (s *Server) writeParseError(conn net.Conn, status response.StatusCode) {
+	s.writeError(&response.Writer{
+		Conn:        conn,
+		Status:      status,
+		Headers:     response.GetDefaultHeaders(0),
+		WriterState: response.StatusLine,
+	})
+}
+
 func (s *Server) writeError(responseWriter *response.Writer) {
 	// Write the HTTP status line
 	err := responseWriter.WriteStatusLine()
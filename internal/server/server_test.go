@@ -0,0 +1,464 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/accesslog"
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/KDT2006/go-http/internal/metrics"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingServer serves handlers that wait for their request context to be done
+// and report its cause.
+func blockingServer(t *testing.T, opts Options) (*Server, chan error) {
+	causes := make(chan error, 1)
+	s, err := ServeWithOptions(0, func(w *response.Writer, req *request.Request) error {
+		<-req.Context().Done()
+		causes <- context.Cause(req.Context())
+		return nil
+	}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, causes
+}
+
+func sendRequest(t *testing.T, s *Server) net.Conn {
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	return conn
+}
+
+func waitCause(t *testing.T, causes chan error) error {
+	select {
+	case err := <-causes:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("request context wasn't cancelled")
+		return nil
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	// Test: Client hanging up
+	s, causes := blockingServer(t, Options{})
+	conn := sendRequest(t, s)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	assert.ErrorIs(t, waitCause(t, causes), ErrClientDisconnected)
+
+	// Test: Client hanging up after sending a 100-continue body
+	causes = make(chan error, 1)
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) error {
+		if _, err := req.ReadBody(); err != nil {
+			return err
+		}
+		<-req.Context().Done()
+		causes <- context.Cause(req.Context())
+		return nil
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	conn, err = net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\nbody"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	assert.ErrorIs(t, waitCause(t, causes), ErrClientDisconnected)
+
+	// Test: Half-closed client still gets the response with AllowHalfClose
+	s, err = ServeWithOptions(0, func(w *response.Writer, req *request.Request) error {
+		time.Sleep(100 * time.Millisecond)
+		_, err := w.Write([]byte(fmt.Sprint(context.Cause(req.Context()))))
+		return err
+	}, Options{AllowHalfClose: true})
+	require.NoError(t, err)
+	defer s.Close()
+	conn = sendRequest(t, s)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(resp), "\r\n\r\n<nil>"))
+
+	// Test: Write timeout
+	s, causes = blockingServer(t, Options{WriteTimeout: 50 * time.Millisecond})
+	sendRequest(t, s)
+	assert.ErrorIs(t, waitCause(t, causes), ErrWriteTimeout)
+
+	// Test: Server shutdown
+	s, causes = blockingServer(t, Options{})
+	sendRequest(t, s)
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, waitCause(t, causes), ErrServerClosed)
+}
+
+func TestRequestContextValues(t *testing.T) {
+	type key struct{}
+	req := &request.Request{}
+	assert.Equal(t, context.Background(), req.Context())
+
+	// Test: Middleware adds a value for the next handler
+	withValue := req.WithContext(context.WithValue(req.Context(), key{}, "value"))
+	assert.Equal(t, "value", withValue.Context().Value(key{}))
+	assert.Nil(t, req.Context().Value(key{}))
+}
+
+// roundTrip sends raw to a server running handler and returns the whole response.
+func roundTrip(t *testing.T, handler HandlerFunc, raw string) string {
+	s, err := Serve(0, handler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte(raw))
+	require.NoError(t, err)
+
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(resp)
+}
+
+func TestErrorResponses(t *testing.T) {
+	notFound := func(w *response.Writer, req *request.Request) error {
+		// Replaced by the error response
+		w.Headers = headers.NewHeaders()
+		w.Headers.Set("X-Partial", "1")
+		w.Write([]byte("partial"))
+		return &HandleError{StatusCode: response.NotFound, Message: "No <such> thing"}
+	}
+
+	// Test: Plain text without a preference
+	resp := roundTrip(t, notFound, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+	assert.Contains(t, resp, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, resp, "Vary: Accept\r\n")
+	assert.NotContains(t, resp, "X-Partial")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n404 Not Found\nNo <such> thing\n"))
+
+	// Test: HTML for browsers
+	resp = roundTrip(t, notFound, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept: text/html,*/*;q=0.8\r\n\r\n")
+	assert.Contains(t, resp, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, resp, "<p>No &lt;such&gt; thing</p>")
+
+	// Test: Problem details for JSON clients
+	resp = roundTrip(t, notFound, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept: application/json\r\n\r\n")
+	assert.Contains(t, resp, "Content-Type: application/problem+json\r\n")
+	assert.True(t, strings.HasSuffix(resp, `{"type":"about:blank","title":"Not Found","status":404,"detail":"No <such> thing"}`+"\n"))
+
+	// Test: Other errors are a 500 that doesn't leak the error
+	resp = roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		return errors.New("secret database failure")
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, resp, "secret")
+
+	// Test: Committed responses are left alone
+	resp = roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		w.Write([]byte("started"))
+		w.Flush()
+		return &HandleError{StatusCode: response.BadRequest}
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "started")
+
+	// Test: Unsupported expectations
+	resp = roundTrip(t, notFound, "GET / HTTP/1.1\r\nHost: localhost\r\nExpect: magic\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 417 Expectation Failed\r\n"))
+
+	// Test: Headers of the error are kept
+	resp = roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		allow := headers.NewHeaders()
+		allow.Set("Allow", "GET")
+		return &HandleError{StatusCode: response.MethodNotAllowed, Headers: allow}
+	}, "POST / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "Allow: GET\r\n")
+
+	// Test: Errors sent by the response package are negotiated too
+	resp = roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		return response.ServeContent(w, req, strings.NewReader("0123456789"), time.Time{})
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\nRange: bytes=20-\r\nAccept: application/json\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, resp, "Content-Range: bytes */10\r\n")
+	assert.Contains(t, resp, "Content-Type: application/problem+json\r\n")
+
+	// Test: Malformed requests are the client's fault
+	resp = roundTrip(t, notFound, "nonsense\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+	resp = roundTrip(t, notFound, "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+
+	// Test: Bodies over a size limit
+	resp = roundTrip(t, notFound, "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n7fffffff\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: Handlers returning the error of reading the body
+	resp = roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		_, err := req.ReadBody()
+		return err
+	}, "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 400 Bad Request\r\n"))
+}
+
+func TestExpectContinue(t *testing.T) {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) error {
+		if req.Headers.Get("Content-Length") != "5" {
+			return &HandleError{StatusCode: response.ContentTooLarge}
+		}
+		body, err := req.ReadBody()
+		if err != nil {
+			return err
+		}
+		w.Write(body)
+		return nil
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	dial := func(head string) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		_, err = conn.Write([]byte(head))
+		require.NoError(t, err)
+		return conn, bufio.NewReader(conn)
+	}
+
+	// Test: 100 Continue comes before the body is sent, once the handler reads it
+	conn, r := dial("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	resp, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(resp), "\r\n\r\nhello"))
+
+	// Test: Handlers rejecting by the headers answer without 100 Continue
+	_, r = dial("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 1000000\r\n\r\n")
+	resp, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.NotContains(t, string(resp), "100 Continue")
+
+	// Test: Unsupported expectations are refused without 100 Continue
+	_, r = dial("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue, magic\r\nContent-Length: 5\r\n\r\n")
+	resp, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 417 Expectation Failed\r\n"))
+	assert.NotContains(t, string(resp), "100 Continue")
+}
+
+func TestMaxBodySize(t *testing.T) {
+	s, err := ServeWithOptions(0, func(w *response.Writer, req *request.Request) error {
+		body, err := req.ReadBody()
+		if err != nil {
+			return err
+		}
+		w.Write(body)
+		return nil
+	}, Options{MaxBodySize: 5})
+	require.NoError(t, err)
+	defer s.Close()
+
+	send := func(raw string) string {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		resp, _ := io.ReadAll(conn)
+		return string(resp)
+	}
+
+	// Test: Bodies within the limit
+	resp := send("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Content-Length and chunked bodies over the limit
+	resp = send("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 6\r\n\r\nhello!")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+	resp = send("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello!\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: No 100 Continue for bodies announced over the limit
+	resp = send("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 6\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+}
+
+func TestPanicRecovery(t *testing.T) {
+	// Test: Panics before anything was committed get a 500
+	resp := roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		w.Write([]byte("buffered"))
+		panic("boom")
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, resp, "buffered")
+	assert.NotContains(t, resp, "boom")
+
+	// Test: Committed responses are cut off, not completed
+	resp = roundTrip(t, func(w *response.Writer, req *request.Request) error {
+		w.Headers = headers.NewHeaders()
+		w.Headers.Set("Transfer-Encoding", "chunked")
+		w.Write([]byte("partial"))
+		w.Flush()
+		panic("boom")
+	}, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "7\r\npartial\r\n"))
+
+	// Test: The hook gets the value and stack, the server keeps serving
+	type report struct {
+		target string
+		value  any
+		stack  string
+	}
+	reports := make(chan report, 1)
+	s, err := ServeWithOptions(0, func(w *response.Writer, req *request.Request) error {
+		panic(errors.New("boom"))
+	}, Options{PanicHook: func(req *request.Request, value any, stack []byte) {
+		reports <- report{target: req.RequestLine.RequestTarget, value: value, stack: string(stack)}
+	}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	for range 2 {
+		conn := sendRequest(t, s)
+		resp, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 500 Internal Server Error\r\n"))
+
+		r := <-reports
+		assert.Equal(t, "/", r.target)
+		assert.EqualError(t, r.value.(error), "boom")
+		assert.Contains(t, r.stack, "TestPanicRecovery")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	records := make(chan accesslog.Record, 1)
+	s, err := ServeWithOptions(0, func(w *response.Writer, req *request.Request) error {
+		w.Write([]byte("hello"))
+		return nil
+	}, Options{AccessLog: func(rec accesslog.Record) { records <- rec }})
+	require.NoError(t, err)
+	defer s.Close()
+
+	send := func(raw string) accesslog.Record {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		io.ReadAll(conn)
+		return <-records
+	}
+
+	// Test: Request and response are described
+	rec := send("POST /upload?x=1 HTTP/1.1\r\nHost: localhost\r\nUser-Agent: test\r\nContent-Length: 4\r\nX-Request-ID: req-1\r\n\r\nbody")
+	assert.Equal(t, "POST", rec.Method)
+	assert.Equal(t, "/upload?x=1", rec.Target)
+	assert.Equal(t, "HTTP/1.1", rec.Proto)
+	assert.Equal(t, response.OK, rec.Status)
+	assert.Equal(t, "test", rec.UserAgent)
+	assert.Equal(t, "req-1", rec.RequestID)
+	assert.Equal(t, int64(4), rec.BytesIn)
+	assert.Equal(t, int64(5), rec.BytesOut)
+	assert.NotEmpty(t, rec.RemoteAddr)
+
+	// Test: HEAD keeps its method, unusable request IDs are replaced
+	rec = send("HEAD / HTTP/1.1\r\nHost: localhost\r\nX-Request-ID: has spaces\r\n\r\n")
+	assert.Equal(t, "HEAD", rec.Method)
+	assert.Equal(t, int64(0), rec.BytesOut)
+	assert.Len(t, rec.RequestID, 32)
+
+	// Test: Unparseable requests
+	rec = send("nonsense\r\n\r\n")
+	assert.Equal(t, response.BadRequest, rec.Status)
+	assert.Empty(t, rec.Method)
+
+	// Test: Body too large
+	rec = send("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n7fffffff\r\n")
+	assert.Equal(t, response.ContentTooLarge, rec.Status)
+	assert.Equal(t, "POST", rec.Method)
+}
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	custom := registry.NewCounter("app_signups_total", "Signups.")
+	s, err := ServeWithOptions(0, func(w *response.Writer, req *request.Request) error {
+		if req.RequestLine.RequestTarget == "/api/missing" {
+			return &HandleError{StatusCode: response.NotFound}
+		}
+		custom.Inc()
+		w.Write([]byte("hello"))
+		return nil
+	}, Options{Metrics: registry, MetricsPath: "/metrics", MetricsRoutes: []string{"/", "/api/"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	send := func(raw string) string {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		resp, _ := io.ReadAll(conn)
+		return string(resp)
+	}
+	send("GET /api/users?id=1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	send("GET /api/missing HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	send("POST /form HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n")
+	send("GET / HTTP/9.9\r\n\r\n")
+	send("MADEUP / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	send("INVENTED / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	// Test: Scrape in the text format
+	resp := send("GET /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "Content-Type: text/plain; version=0.0.4; charset=utf-8\r\n")
+	assert.Contains(t, resp, `http_server_requests_total{method="GET",route="/api/",status="200"} 1`+"\n")
+	assert.Contains(t, resp, `http_server_requests_total{method="GET",route="/api/",status="404"} 1`+"\n")
+	assert.Contains(t, resp, `http_server_requests_total{method="POST",route="/",status="200"} 1`+"\n")
+	assert.Contains(t, resp, `http_server_request_duration_seconds_count{method="GET",route="/api/"} 2`+"\n")
+	assert.Contains(t, resp, `http_server_requests_total{method="_OTHER",route="/",status="200"} 2`+"\n")
+	assert.NotContains(t, resp, "MADEUP")
+	assert.Contains(t, resp, `http_server_parse_errors_total{kind="request_line"} 1`+"\n")
+	assert.Contains(t, resp, "http_server_requests_in_flight 1\n")
+	assert.Contains(t, resp, "http_server_active_connections 1\n")
+	assert.Contains(t, resp, "http_server_accept_errors_total 0\n")
+	assert.Contains(t, resp, "app_signups_total 4\n")
+	assert.NotContains(t, resp, "http_server_read_bytes_total 0\n")
+
+	// Test: The scrape itself is counted, other methods aren't allowed
+	resp = send("POST /metrics HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "Allow: GET, HEAD\r\n")
+	resp = send("GET /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, resp, `http_server_requests_total{method="GET",route="/metrics",status="200"} 1`+"\n")
+}
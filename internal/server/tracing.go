@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/KDT2006/go-http/internal/accesslog"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/tracing"
+)
+
+// finishSpan describes the finished exchange on the request's span and ends it.
+// Attribute names follow the OpenTelemetry HTTP semantic conventions.
+func finishSpan(span *tracing.Span, rec accesslog.Record, route string) {
+	if span == nil {
+		return
+	}
+
+	// Routes and known methods keep span names low-cardinality like metric labels
+	method := normalizeMethod(rec.Method)
+	span.Name = method
+	if method == "_OTHER" {
+		span.Name = "HTTP"
+		span.SetAttribute("http.request.method_original", rec.Method)
+	}
+	if route != "other" {
+		span.Name += " " + route
+		span.SetAttribute("http.route", route)
+	}
+
+	path, query, _ := strings.Cut(rec.Target, "?")
+	span.SetAttribute("http.request.method", method)
+	span.SetAttribute("url.path", path)
+	if query != "" {
+		span.SetAttribute("url.query", query)
+	}
+	span.SetAttribute("network.protocol.version", strings.TrimPrefix(rec.Proto, "HTTP/"))
+	span.SetAttribute("client.address", rec.RemoteAddr)
+	if rec.UserAgent != "" {
+		span.SetAttribute("user_agent.original", rec.UserAgent)
+	}
+	span.SetAttribute("http.request.id", rec.RequestID)
+	span.SetAttribute("http.request.body.size", rec.BytesIn)
+	span.SetAttribute("http.response.body.size", rec.BytesOut)
+	if rec.Status != 0 {
+		span.SetAttribute("http.response.status_code", int(rec.Status))
+	}
+
+	// Only 5xx are server errors, a 4xx is the client's
+	if rec.Status >= response.InternalServerErrror {
+		span.SetError(response.StatusText(rec.Status))
+	}
+	span.Finish()
+}
@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KDT2006/go-http/internal/proxy"
+	"github.com/KDT2006/go-http/internal/server"
+	"github.com/KDT2006/go-http/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	traceparents := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		w.Write([]byte("proxied"))
+	}))
+	defer upstream.Close()
+	p, err := proxy.New(upstream.URL, proxy.Options{StripPrefix: "/httpbin/"})
+	require.NoError(t, err)
+
+	spans := make(chan *tracing.Span, 2)
+	tracer := &tracing.Tracer{BatchSize: 1, Exporter: tracing.ExporterFunc(func(ctx context.Context, batch []*tracing.Span) error {
+		for _, span := range batch {
+			spans <- span
+		}
+		return nil
+	})}
+	defer tracer.Close(context.Background())
+	s, err := server.ServeWithOptions(0, p.Handle, server.Options{Tracer: tracer, MetricsRoutes: []string{"/httpbin/"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	send := func(raw string) string {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		resp, _ := io.ReadAll(conn)
+		return string(resp)
+	}
+	// The client span ends before the server span
+	receive := func() (*tracing.Span, *tracing.Span) {
+		client, server := <-spans, <-spans
+		return server, client
+	}
+
+	// Test: The incoming trace is continued through the proxy hop
+	resp := send("GET /httpbin/get?x=1 HTTP/1.1\r\nHost: localhost\r\ntraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\ntracestate: vendor=abc\r\n\r\n")
+	assert.True(t, strings.HasSuffix(resp, "proxied"))
+	server, client := receive()
+	assert.Equal(t, "GET /httpbin/", server.Name)
+	assert.Equal(t, tracing.SpanKindServer, server.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.Context.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.String())
+	assert.Equal(t, server.Context.SpanID, client.Parent)
+	assert.Equal(t, server.Context.TraceID, client.Context.TraceID)
+	assert.Equal(t, tracing.SpanKindClient, client.Kind)
+	assert.Equal(t, client.Context.Traceparent(), <-traceparents)
+	assert.Contains(t, server.Attributes, tracing.Attribute{Key: "http.route", Value: "/httpbin/"})
+	assert.Contains(t, server.Attributes, tracing.Attribute{Key: "url.path", Value: "/httpbin/get"})
+	assert.Contains(t, server.Attributes, tracing.Attribute{Key: "http.response.status_code", Value: 200})
+	assert.Contains(t, server.Attributes, tracing.Attribute{Key: "http.response.body.size", Value: int64(7)})
+	assert.Contains(t, client.Attributes, tracing.Attribute{Key: "http.response.status_code", Value: 200})
+	assert.Equal(t, "vendor=abc", client.Context.TraceState)
+
+	// Test: Requests without a trace start one
+	send("GET /httpbin/get HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	server, client = receive()
+	assert.False(t, server.Parent.IsValid())
+	assert.Equal(t, server.Context.TraceID, client.Context.TraceID)
+	assert.Equal(t, client.Context.Traceparent(), <-traceparents)
+
+	// Test: Unknown methods don't end up in span names
+	send("MADEUP /httpbin/get HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	server, _ = receive()
+	<-traceparents
+	assert.Equal(t, "HTTP /httpbin/", server.Name)
+	assert.Contains(t, server.Attributes, tracing.Attribute{Key: "http.request.method", Value: "_OTHER"})
+	assert.Contains(t, server.Attributes, tracing.Attribute{Key: "http.request.method_original", Value: "MADEUP"})
+
+	// Test: Unsampled traces are propagated but not exported
+	send("GET /httpbin/get HTTP/1.1\r\nHost: localhost\r\ntraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00\r\n\r\n")
+	got := <-traceparents
+	assert.True(t, strings.HasPrefix(got, "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+	assert.True(t, strings.HasSuffix(got, "-00"))
+	assert.NotContains(t, got, "00f067aa0ba902b7")
+	assert.Empty(t, spans)
+}
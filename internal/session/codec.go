@@ -0,0 +1,90 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Codec encrypts and authenticates cookie values with AES-GCM.
+//
+// The first key is used for encoding, all keys are tried when decoding,
+// so keys can be rotated by prepending a new key and dropping the oldest
+// once every cookie encoded with it has expired.
+type Codec struct {
+	aeads []cipher.AEAD
+
+	// MaxAge rejects values encoded more than MaxAge ago, 0 disables the check
+	MaxAge time.Duration
+}
+
+// NewCodec creates a Codec from one or more 16, 24 or 32 byte AES keys.
+func NewCodec(keys ...[]byte) (*Codec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("error: NewCodec() needs at least one key")
+	}
+
+	c := &Codec{}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid key %d: %w", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+
+	return c, nil
+}
+
+// Encode encrypts value, binding it to name so it can't be replayed under another cookie.
+func (c *Codec) Encode(name string, value []byte) (string, error) {
+	aead := c.aeads[0]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// Prefix the plaintext with the encoding time for MaxAge checks
+	plaintext := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(plaintext, uint64(time.Now().Unix()))
+	plaintext = append(plaintext, value...)
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode authenticates and decrypts a value produced by Encode under the same name.
+func (c *Codec) Decode(name string, encoded string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid encoding: %w", err)
+	}
+
+	for _, aead := range c.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil || len(plaintext) < 8 {
+			continue
+		}
+
+		issued := time.Unix(int64(binary.BigEndian.Uint64(plaintext)), 0)
+		if c.MaxAge > 0 && time.Since(issued) > c.MaxAge {
+			return nil, fmt.Errorf("error: value expired")
+		}
+		return plaintext[8:], nil
+	}
+
+	return nil, fmt.Errorf("error: value could not be authenticated")
+}
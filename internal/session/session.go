@@ -0,0 +1,278 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/cookie"
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/KDT2006/go-http/internal/server"
+)
+
+// Session holds the values of a single client session.
+type Session struct {
+	ID        string            `json:"id"`
+	Values    map[string]string `json:"values"`
+	CreatedAt time.Time         `json:"created_at"`
+	LastSeen  time.Time         `json:"last_seen"`
+
+	isNew bool
+	// oldID is the ID to drop from the store on the next save after Regenerate
+	oldID string
+}
+
+func newSession() (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Session{
+		ID:        id,
+		Values:    map[string]string{},
+		CreatedAt: now,
+		LastSeen:  now,
+		isNew:     true,
+	}, nil
+}
+
+// Get returns the value stored under key.
+func (s *Session) Get(key string) string {
+	return s.Values[key]
+}
+
+// Set stores value under key.
+func (s *Session) Set(key string, value string) {
+	s.Values[key] = value
+}
+
+// Delete removes key from the session.
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+}
+
+// IsNew reports whether the session was created during this request.
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Options configure the session cookie and expiry.
+type Options struct {
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   cookie.SameSite
+
+	// IdleTimeout expires sessions that haven't been seen for this long
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires sessions this long after creation regardless of activity
+	AbsoluteTimeout time.Duration
+}
+
+// Manager loads and saves sessions for requests using a Store.
+type Manager struct {
+	store Store
+	codec *Codec
+	opts  Options
+
+	// Sessions loaded by Middleware for in-flight requests
+	sessions sync.Map // *request.Request -> *Session
+}
+
+// NewManager creates a Manager. Session cookies are always encrypted
+// with codec, whatever the store puts in them.
+func NewManager(store Store, codec *Codec, opts Options) *Manager {
+	if opts.CookieName == "" {
+		opts.CookieName = "session"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == cookie.SameSiteDefault {
+		opts.SameSite = cookie.SameSiteLax
+	}
+
+	return &Manager{
+		store: store,
+		codec: codec,
+		opts:  opts,
+	}
+}
+
+// Middleware loads the request's session before calling next, making it available through Get.
+func (m *Manager) Middleware(next server.HandlerFunc) server.HandlerFunc {
+	return func(w *response.Writer, req *request.Request) error {
+		s, err := m.load(req)
+		if err != nil {
+			return &server.HandleError{
+				StatusCode: response.InternalServerErrror,
+				Err:        err,
+			}
+		}
+
+		// The cookie expires IdleTimeout after it was set and CookieStore can't
+		// record activity without one, so sessions in use are saved again
+		if !s.IsNew() && m.opts.IdleTimeout > 0 {
+			if err := m.Save(w, s); err != nil {
+				return &server.HandleError{
+					StatusCode: response.InternalServerErrror,
+					Err:        err,
+				}
+			}
+		}
+
+		m.sessions.Store(req, s)
+		defer m.sessions.Delete(req)
+
+		return next(w, req)
+	}
+}
+
+// Get returns the session of req. Outside of Middleware the session is loaded on
+// every call, and its cookie isn't renewed until Save.
+func (m *Manager) Get(req *request.Request) (*Session, error) {
+	if s, ok := m.sessions.Load(req); ok {
+		return s.(*Session), nil
+	}
+	return m.load(req)
+}
+
+func (m *Manager) load(req *request.Request) (*Session, error) {
+	c, err := req.Cookie(m.opts.CookieName)
+	if err != nil {
+		return newSession()
+	}
+
+	token, err := m.codec.Decode(m.opts.CookieName, c.Value)
+	if err != nil {
+		// Tampered, rotated out or otherwise undecodable cookies start over
+		return newSession()
+	}
+
+	s, err := m.store.Load(string(token))
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return newSession()
+	}
+
+	if m.expired(s) {
+		if err := m.store.Delete(s.ID); err != nil {
+			return nil, err
+		}
+		return newSession()
+	}
+
+	s.LastSeen = time.Now()
+	if err := m.store.Touch(s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *Manager) expired(s *Session) bool {
+	now := time.Now()
+	if m.opts.IdleTimeout > 0 && now.Sub(s.LastSeen) > m.opts.IdleTimeout {
+		return true
+	}
+	if m.opts.AbsoluteTimeout > 0 && now.Sub(s.CreatedAt) > m.opts.AbsoluteTimeout {
+		return true
+	}
+	return false
+}
+
+// Save persists s and sets the session cookie. It must be called before w.WriteHeaders.
+func (m *Manager) Save(w *response.Writer, s *Session) error {
+	if s.oldID != "" {
+		if err := m.store.Delete(s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+
+	s.LastSeen = time.Now()
+	token, err := m.store.Save(s)
+	if err != nil {
+		return err
+	}
+
+	value, err := m.codec.Encode(m.opts.CookieName, []byte(token))
+	if err != nil {
+		return err
+	}
+
+	return w.SetCookie(m.cookie(value, m.maxAge(s)))
+}
+
+// Regenerate gives s a new ID while keeping its values and CreatedAt, so the
+// absolute timeout still counts from the start. Call it whenever the
+// privilege level changes (login, logout, sudo) to prevent session fixation.
+// The old ID is removed from the store on the next Save.
+func (m *Manager) Regenerate(s *Session) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.ID
+	}
+	s.ID = id
+	return nil
+}
+
+// Destroy deletes s from the store and expires the session cookie.
+func (m *Manager) Destroy(w *response.Writer, s *Session) error {
+	if err := m.store.Delete(s.ID); err != nil {
+		return err
+	}
+	s.Values = map[string]string{}
+
+	return w.SetCookie(m.cookie("", -1))
+}
+
+func (m *Manager) maxAge(s *Session) int {
+	var remaining time.Duration
+	if m.opts.IdleTimeout > 0 {
+		remaining = m.opts.IdleTimeout
+	}
+	if m.opts.AbsoluteTimeout > 0 {
+		left := time.Until(s.CreatedAt.Add(m.opts.AbsoluteTimeout))
+		if remaining == 0 || left < remaining {
+			remaining = left
+		}
+	}
+	if remaining <= 0 {
+		return 0 // Session cookie
+	}
+	return int(remaining.Seconds())
+}
+
+func (m *Manager) cookie(value string, maxAge int) *cookie.Cookie {
+	return &cookie.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    value,
+		MaxAge:   maxAge,
+		Domain:   m.opts.Domain,
+		Path:     m.opts.Path,
+		Secure:   m.opts.Secure,
+		HttpOnly: true,
+		SameSite: m.opts.SameSite,
+	}
+}
+
+// newID returns a random 256 bit hex session ID.
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,225 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/request"
+	"github.com/KDT2006/go-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestCodec(t *testing.T) {
+	c, err := NewCodec(key1)
+	require.NoError(t, err)
+
+	encoded, err := c.Encode("session", []byte("hello"))
+	require.NoError(t, err)
+
+	decoded, err := c.Decode("session", encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(decoded))
+
+	// Test: Bound to the cookie name
+	_, err = c.Decode("other", encoded)
+	require.Error(t, err)
+
+	// Test: Tampering is detected
+	tampered := []byte(encoded)
+	tampered[len(tampered)-2] ^= 1
+	_, err = c.Decode("session", string(tampered))
+	require.Error(t, err)
+
+	// Test: Key rotation, old values still decode with the new key first
+	rotated, err := NewCodec(key2, key1)
+	require.NoError(t, err)
+	decoded, err = rotated.Decode("session", encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(decoded))
+
+	// Test: Dropped keys no longer decode
+	onlyNew, err := NewCodec(key2)
+	require.NoError(t, err)
+	_, err = onlyNew.Decode("session", encoded)
+	require.Error(t, err)
+
+	// Test: Invalid key size
+	_, err = NewCodec([]byte("short"))
+	require.Error(t, err)
+}
+
+var setCookieRe = regexp.MustCompile(`Set-Cookie: session=([^;]*)`)
+
+// roundTrip runs handler through m.Middleware for a request carrying cookieValue
+// and returns the new session cookie value, if one was set.
+func roundTrip(t *testing.T, m *Manager, cookieValue string, handler func(w *response.Writer, s *Session)) string {
+	raw := "GET / HTTP/1.1\r\nHost: localhost\r\n"
+	if cookieValue != "" {
+		raw += fmt.Sprintf("Cookie: session=%s\r\n", cookieValue)
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	w := &response.Writer{
+		Conn:        buf,
+		Headers:     response.GetDefaultHeaders(0),
+		WriterState: response.StatusLine,
+	}
+	wrapped := m.Middleware(func(w *response.Writer, req *request.Request) error {
+		s, err := m.Get(req)
+		require.NoError(t, err)
+		handler(w, s)
+		require.NoError(t, w.WriteStatusLine())
+		require.NoError(t, w.WriteHeaders())
+		return nil
+	})
+	require.Nil(t, wrapped(w, req))
+
+	match := setCookieRe.FindStringSubmatch(buf.String())
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func testStore(t *testing.T, store Store) {
+	codec, err := NewCodec(key1)
+	require.NoError(t, err)
+	m := NewManager(store, codec, Options{IdleTimeout: time.Hour})
+
+	// Test: New session is created and saved
+	var firstID string
+	value := roundTrip(t, m, "", func(w *response.Writer, s *Session) {
+		assert.True(t, s.IsNew())
+		firstID = s.ID
+		s.Set("user", "alice")
+		require.NoError(t, m.Save(w, s))
+	})
+	require.NotEmpty(t, value)
+
+	// Test: Session is restored from the cookie
+	value = roundTrip(t, m, value, func(w *response.Writer, s *Session) {
+		assert.False(t, s.IsNew())
+		assert.Equal(t, firstID, s.ID)
+		assert.Equal(t, "alice", s.Get("user"))
+
+		// Test: Regenerate on privilege change keeps the creation time
+		createdAt := s.CreatedAt
+		require.NoError(t, m.Regenerate(s))
+		assert.NotEqual(t, firstID, s.ID)
+		assert.Equal(t, createdAt, s.CreatedAt)
+		require.NoError(t, m.Save(w, s))
+	})
+	require.NotEmpty(t, value)
+
+	roundTrip(t, m, value, func(w *response.Writer, s *Session) {
+		assert.NotEqual(t, firstID, s.ID)
+		assert.Equal(t, "alice", s.Get("user"))
+	})
+
+	// Test: Garbage cookies start a new session
+	roundTrip(t, m, "garbage", func(w *response.Writer, s *Session) {
+		assert.True(t, s.IsNew())
+	})
+
+	// Test: Sessions in use don't idle out, unused ones do
+	idle := NewManager(store, codec, Options{IdleTimeout: 100 * time.Millisecond})
+	value = roundTrip(t, idle, "", func(w *response.Writer, s *Session) {
+		firstID = s.ID
+		require.NoError(t, idle.Save(w, s))
+	})
+	for range 3 {
+		time.Sleep(60 * time.Millisecond)
+		value = roundTrip(t, idle, value, func(w *response.Writer, s *Session) {
+			assert.False(t, s.IsNew())
+			assert.Equal(t, firstID, s.ID)
+		})
+		require.NotEmpty(t, value)
+	}
+	time.Sleep(150 * time.Millisecond)
+	roundTrip(t, idle, value, func(w *response.Writer, s *Session) {
+		assert.True(t, s.IsNew())
+	})
+}
+
+func TestCookieStore(t *testing.T) {
+	testStore(t, CookieStore{})
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+	testStore(t, store)
+
+	// Test: Regenerated IDs are removed from the store
+	s, err := newSession()
+	require.NoError(t, err)
+	_, err = store.Save(s)
+	require.NoError(t, err)
+	oldID := s.ID
+	s.isNew = false
+
+	codec, _ := NewCodec(key1)
+	m := NewManager(store, codec, Options{})
+	require.NoError(t, m.Regenerate(s))
+	require.NoError(t, m.Save(&response.Writer{Conn: new(bytes.Buffer)}, s))
+	loaded, err := store.Load(oldID)
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+	testStore(t, store)
+
+	// Test: Tokens that aren't session IDs are rejected
+	s, err := store.Load("../../etc/passwd")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	// Test: Touch records LastSeen without changing the values
+	s, err = newSession()
+	require.NoError(t, err)
+	s.Set("user", "alice")
+	_, err = store.Save(s)
+	require.NoError(t, err)
+	s.Set("user", "bob")
+	s.LastSeen = s.LastSeen.Add(time.Minute)
+	require.NoError(t, store.Touch(s))
+	loaded, err := store.Load(s.ID)
+	require.NoError(t, err)
+	assert.True(t, s.LastSeen.Equal(loaded.LastSeen))
+	assert.Equal(t, "alice", loaded.Get("user"))
+}
+
+func TestExpiry(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+	codec, _ := NewCodec(key1)
+	m := NewManager(store, codec, Options{AbsoluteTimeout: time.Minute})
+
+	s, err := newSession()
+	require.NoError(t, err)
+	s.CreatedAt = time.Now().Add(-2 * time.Minute)
+	_, err = store.Save(s)
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode("session", []byte(s.ID))
+	require.NoError(t, err)
+	roundTrip(t, m, encoded, func(w *response.Writer, loaded *Session) {
+		assert.True(t, loaded.IsNew())
+		assert.NotEqual(t, s.ID, loaded.ID)
+	})
+}
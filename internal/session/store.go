@@ -0,0 +1,332 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store persists sessions. The token returned by Save is what ends up
+// (encrypted) in the session cookie and is handed back to Load.
+type Store interface {
+	// Load returns the session for token, or nil if there is none.
+	Load(token string) (*Session, error)
+	// Save persists s and returns the token referencing it.
+	Save(s *Session) (string, error)
+	// Touch records activity on s without changing its values.
+	Touch(s *Session) error
+	// Delete removes the session with the given ID.
+	Delete(id string) error
+}
+
+// CookieStore keeps the whole session inside the cookie.
+// Sessions can't be revoked server-side, Delete only clears the cookie.
+type CookieStore struct{}
+
+// maxCookieSize is the size most browsers cap a single cookie at.
+const maxCookieSize = 4096
+
+func (CookieStore) Load(token string) (*Session, error) {
+	s := &Session{}
+	if err := json.Unmarshal([]byte(token), s); err != nil {
+		return nil, nil // Treat undecodable sessions as missing
+	}
+	if s.Values == nil {
+		s.Values = map[string]string{}
+	}
+	return s, nil
+}
+
+func (CookieStore) Save(s *Session) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	// Account for the encryption and base64 overhead
+	if (len(data)+36)*4/3 > maxCookieSize {
+		return "", fmt.Errorf("error: session too large for a cookie: %d bytes", len(data))
+	}
+	return string(data), nil
+}
+
+func (CookieStore) Touch(s *Session) error {
+	return nil
+}
+
+func (CookieStore) Delete(id string) error {
+	return nil
+}
+
+// MemoryStore keeps sessions in memory and evicts them once they
+// haven't been saved or touched for TTL.
+type MemoryStore struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	done     chan struct{}
+}
+
+type memoryEntry struct {
+	session Session
+	expires time.Time
+}
+
+// NewMemoryStore creates a MemoryStore and starts its eviction loop. Call Close to stop it.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		ttl:      ttl,
+		sessions: map[string]memoryEntry{},
+		done:     make(chan struct{}),
+	}
+
+	go m.evictLoop()
+
+	return m
+}
+
+func (m *MemoryStore) Load(token string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.sessions[token]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, nil
+	}
+	return copySession(&entry.session), nil
+}
+
+func (m *MemoryStore) Save(s *Session) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.ID] = memoryEntry{
+		session: *copySession(s),
+		expires: time.Now().Add(m.ttl),
+	}
+	return s.ID, nil
+}
+
+func (m *MemoryStore) Touch(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.sessions[s.ID]; ok {
+		entry.session.LastSeen = s.LastSeen
+		entry.expires = time.Now().Add(m.ttl)
+		m.sessions[s.ID] = entry
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// Close stops the eviction loop.
+func (m *MemoryStore) Close() {
+	close(m.done)
+}
+
+func (m *MemoryStore) evictLoop() {
+	interval := m.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for id, entry := range m.sessions {
+				if now.After(entry.expires) {
+					delete(m.sessions, id)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// FileStore keeps one JSON file per session in a directory.
+// Files older than TTL are treated as missing and removed by Cleanup.
+type FileStore struct {
+	dir string
+	ttl time.Duration
+	mu  sync.Mutex
+}
+
+// NewFileStore creates a FileStore in dir, creating the directory if needed.
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, ttl: ttl}, nil
+}
+
+func (f *FileStore) Load(token string) (*Session, error) {
+	path, ok := f.path(token)
+	if !ok {
+		return nil, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if time.Since(info.ModTime()) > f.ttl {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, nil
+	}
+	if s.Values == nil {
+		s.Values = map[string]string{}
+	}
+	return s, nil
+}
+
+func (f *FileStore) Save(s *Session) (string, error) {
+	path, ok := f.path(s.ID)
+	if !ok {
+		return "", fmt.Errorf("error: invalid session ID")
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := writeFile(path, data); err != nil {
+		return "", err
+	}
+	return s.ID, nil
+}
+
+func (f *FileStore) Touch(s *Session) error {
+	path, ok := f.path(s.ID)
+	if !ok {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// LastSeen is rewritten, the stored values stay as they were saved
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stored := &Session{}
+	if err := json.Unmarshal(data, stored); err != nil {
+		return nil
+	}
+	stored.LastSeen = s.LastSeen
+	data, err = json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+func (f *FileStore) Delete(id string) error {
+	path, ok := f.path(id)
+	if !ok {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Cleanup removes expired session files.
+func (f *FileStore) Cleanup() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > f.ttl {
+			os.Remove(filepath.Join(f.dir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// writeFile writes to a temp file and renames it so readers never see a partial session.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// path maps a session ID to its file, rejecting anything that isn't
+// an ID produced by newID so tokens can't escape the directory.
+func (f *FileStore) path(id string) (string, bool) {
+	if len(id) != 64 {
+		return "", false
+	}
+	for i := 0; i < len(id); i++ {
+		if (id[i] < '0' || id[i] > '9') && (id[i] < 'a' || id[i] > 'f') {
+			return "", false
+		}
+	}
+	return filepath.Join(f.dir, id+".json"), true
+}
+
+// copySession returns a deep copy of s as it would look after being loaded from a store.
+func copySession(s *Session) *Session {
+	c := *s
+	c.isNew = false
+	c.oldID = ""
+	c.Values = maps.Clone(s.Values)
+	if c.Values == nil {
+		c.Values = map[string]string{}
+	}
+	return &c
+}
@@ -0,0 +1,186 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/client"
+	"github.com/KDT2006/go-http/internal/tracing"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	scopeName      = "github.com/KDT2006/go-http"
+	// statusCodeError is STATUS_CODE_ERROR of the OTLP Status message
+	statusCodeError = 2
+)
+
+// Exporter sends spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+type Exporter struct {
+	// Endpoint is the full traces URL, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// Headers are added to every export request, e.g. for authentication
+	Headers map[string]string
+	// Client sends the export requests, defaults to a client with a 10s timeout
+	Client *client.Client
+}
+
+// New creates an Exporter for endpoint.
+func New(endpoint string, serviceName string) *Exporter {
+	return &Exporter{
+		Endpoint:    endpoint,
+		ServiceName: serviceName,
+		Client:      &client.Client{Timeout: defaultTimeout},
+	}
+}
+
+func (e *Exporter) Export(ctx context.Context, spans []*tracing.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := client.NewRequest(ctx, "POST", e.Endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Headers.Set("Content-Type", "application/json")
+	for key, value := range e.Headers {
+		req.Headers.Set(key, value)
+	}
+
+	c := e.Client
+	if c == nil {
+		c = client.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("error: exporting spans failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// The types below mirror the JSON mapping of ExportTraceServiceRequest. Trace and
+// span IDs are hex strings and 64 bit integers are decimal strings in OTLP/JSON.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	TraceState        string     `json:"traceState,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            *status    `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *Exporter) request(spans []*tracing.Span) exportRequest {
+	out := make([]span, 0, len(spans))
+	for _, s := range spans {
+		o := span{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.Parent.IsValid() {
+			o.ParentSpanID = s.Parent.String()
+		}
+		for _, a := range s.Attributes {
+			o.Attributes = append(o.Attributes, attribute(a.Key, a.Value))
+		}
+		if s.Error {
+			o.Status = &status{Code: statusCodeError, Message: s.ErrorMessage}
+		}
+		out = append(out, o)
+	}
+
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{attribute("service.name", e.ServiceName)}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: out}},
+	}}}
+}
+
+func attribute(key string, value any) keyValue {
+	var v anyValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return keyValue{Key: key, Value: v}
+}
@@ -0,0 +1,68 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	var got *http.Request
+	var body map[string]any
+	status := http.StatusOK
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		w.WriteHeader(status)
+	}))
+	defer collector.Close()
+
+	e := New(collector.URL+"/v1/traces", "test-service")
+	e.Headers = map[string]string{"Authorization": "Bearer token"}
+	start := time.Unix(1700000000, 5)
+	span := &tracing.Span{
+		Name:       "GET /api/",
+		Kind:       tracing.SpanKindServer,
+		Context:    tracing.SpanContext{TraceID: tracing.TraceID{0xab}, SpanID: tracing.SpanID{0xcd}, TraceState: "vendor=1", Sampled: true},
+		Parent:     tracing.SpanID{0xef},
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: []tracing.Attribute{{Key: "http.route", Value: "/api/"}, {Key: "http.response.status_code", Value: 500}, {Key: "http.response.body.size", Value: int64(12)}},
+		Error:      true,
+	}
+
+	// Test: Spans are posted as OTLP JSON
+	require.NoError(t, e.Export(context.Background(), []*tracing.Span{span}))
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/v1/traces", got.URL.Path)
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", got.Header.Get("Authorization"))
+
+	var want map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"test-service"}}]},
+		"scopeSpans":[{"scope":{"name":"github.com/KDT2006/go-http"},"spans":[{
+			"traceId":"ab000000000000000000000000000000","spanId":"cd00000000000000","parentSpanId":"ef00000000000000",
+			"traceState":"vendor=1","name":"GET /api/","kind":2,
+			"startTimeUnixNano":"1700000000000000005","endTimeUnixNano":"1700000001000000005",
+			"attributes":[
+				{"key":"http.route","value":{"stringValue":"/api/"}},
+				{"key":"http.response.status_code","value":{"intValue":"500"}},
+				{"key":"http.response.body.size","value":{"intValue":"12"}}],
+			"status":{"code":2}}]}]}]}`), &want))
+	assert.Equal(t, want, body)
+
+	// Test: Rejected exports are errors
+	status = http.StatusBadRequest
+	assert.ErrorContains(t, e.Export(context.Background(), []*tracing.Span{span}), "status 400")
+}
@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 512
+	defaultMaxQueueSize  = 2048
+	defaultBatchInterval = 5 * time.Second
+	defaultExportTimeout = 10 * time.Second
+)
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// ExporterFunc adapts a function to an Exporter.
+type ExporterFunc func(ctx context.Context, spans []*Span) error
+
+func (f ExporterFunc) Export(ctx context.Context, spans []*Span) error {
+	return f(ctx, spans)
+}
+
+// Tracer starts spans and exports the sampled ones in batches.
+type Tracer struct {
+	Exporter Exporter
+	// BatchSize spans are exported together, a partial batch is exported every
+	// BatchInterval. Default to 512 and 5s
+	BatchSize     int
+	BatchInterval time.Duration
+	// MaxQueueSize caps the spans waiting to be exported, later ones are dropped. Defaults to 2048
+	MaxQueueSize int
+	// ExportTimeout limits a single export, defaults to 10s
+	ExportTimeout time.Duration
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int64
+	start   sync.Once
+	full    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	closed  bool
+}
+
+// Start starts a span as a child of parent, or as the root of a new trace if
+// parent is invalid. A root span is sampled, a child inherits parent's decision.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	span := &Span{
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+		tracer: t,
+	}
+	if parent.IsValid() {
+		span.Context = parent
+		span.Parent = parent.SpanID
+	} else {
+		span.Context = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	span.Context.SpanID = newSpanID()
+	return ContextWithSpan(ctx, span), span
+}
+
+// Dropped returns the number of spans dropped because the queue was full.
+func (t *Tracer) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Close exports the queued spans and stops the background exports.
+func (t *Tracer) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	running := t.done != nil
+	t.mu.Unlock()
+
+	if running {
+		close(t.done)
+		<-t.stopped
+	}
+	return t.export(ctx, t.take())
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	if t.Exporter == nil {
+		return
+	}
+	t.start.Do(func() {
+		t.mu.Lock()
+		t.full = make(chan struct{}, 1)
+		t.done = make(chan struct{})
+		t.stopped = make(chan struct{})
+		closed := t.closed
+		t.mu.Unlock()
+		if !closed {
+			go t.loop()
+		}
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	maxQueue := t.MaxQueueSize
+	if maxQueue == 0 {
+		maxQueue = defaultMaxQueueSize
+	}
+	if t.closed || len(t.queue) >= maxQueue {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, span)
+	if len(t.queue) >= t.batchSize() {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop exports a batch whenever one fills up or the interval passes.
+func (t *Tracer) loop() {
+	defer close(t.stopped)
+
+	interval := t.BatchInterval
+	if interval == 0 {
+		interval = defaultBatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.full:
+		case <-t.done:
+			return
+		}
+
+		timeout := t.ExportTimeout
+		if timeout == 0 {
+			timeout = defaultExportTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := t.export(ctx, t.take()); err != nil {
+			log.Println("error: exporting spans failed:", err)
+		}
+		cancel()
+	}
+}
+
+// take removes and returns all queued spans.
+func (t *Tracer) take() []*Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := t.queue
+	t.queue = nil
+	return spans
+}
+
+// export hands spans to the exporter in batches of BatchSize.
+func (t *Tracer) export(ctx context.Context, spans []*Span) error {
+	for len(spans) > 0 {
+		n := min(len(spans), t.batchSize())
+		if err := t.Exporter.Export(ctx, spans[:n]); err != nil {
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+func (t *Tracer) batchSize() int {
+	if t.BatchSize == 0 {
+		return defaultBatchSize
+	}
+	return t.BatchSize
+}
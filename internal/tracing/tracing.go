@@ -0,0 +1,241 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/headers"
+)
+
+// TraceID identifies a whole trace, SpanID a single span in it (W3C Trace Context).
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext is the part of a span that's propagated between services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled is the sampled flag, spans that aren't sampled are propagated but not exported
+	Sampled bool
+	// TraceState is the vendor specific tracestate header, passed on as is
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a traceparent header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value (W3C Trace Context Section 3.2).
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("error: malformed traceparent: %q", value)
+	}
+
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return SpanContext{}, fmt.Errorf("error: invalid traceparent version: %q", parts[0])
+	}
+	// Version 00 has exactly four fields, later versions may append more
+	if version[0] == 0 && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("error: malformed traceparent: %q", value)
+	}
+
+	var sc SpanContext
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("error: invalid traceparent ids: %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return SpanContext{}, fmt.Errorf("error: invalid traceparent flags: %q", parts[3])
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex into dst, which it must fill exactly.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Extract returns the span context propagated in h, it's invalid if there's none.
+func Extract(h headers.Headers) SpanContext {
+	sc, err := ParseTraceparent(h.Get("traceparent"))
+	if err != nil {
+		return SpanContext{}
+	}
+	sc.TraceState = h.Get("tracestate")
+	return sc
+}
+
+// Inject sets the traceparent and tracestate headers for the span in ctx, if any.
+func Inject(ctx context.Context, h headers.Headers) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	h.Set("traceparent", span.Context.Traceparent())
+	if span.Context.TraceState != "" {
+		h.Set("tracestate", span.Context.TraceState)
+	} else {
+		h.Del("tracestate")
+	}
+}
+
+type SpanKind int
+
+// Span kinds, numbered as in OTLP
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+type Attribute struct {
+	Key string
+	// Value is a string, bool, int, int64 or float64
+	Value any
+}
+
+// Span is a timed operation within a trace. Its methods do nothing on a nil
+// span, so code outside of a trace doesn't have to check.
+type Span struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	// Error and ErrorMessage mark a failed operation
+	Error        bool
+	ErrorMessage string
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// SetAttribute sets key to value, replacing an earlier value.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, a := range s.Attributes {
+		if a.Key == key {
+			s.Attributes[i].Value = value
+			return
+		}
+	}
+	s.Attributes = append(s.Attributes, Attribute{Key: key, Value: value})
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Error = true
+	s.ErrorMessage = message
+}
+
+// Finish ends the span and hands it to the tracer's exporter if it's sampled.
+// Only the first call has an effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.Context.Sampled && s.tracer != nil {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span, outbound requests
+// made with it continue the trace.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartChild starts a span as a child of the one in ctx, using its tracer.
+// It returns ctx and a nil span if ctx isn't part of a trace.
+func StartChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind, parent.Context)
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
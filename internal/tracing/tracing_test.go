@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KDT2006/go-http/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceparent(t *testing.T) {
+	// Test: Valid header round trips
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	// Test: Only the sampled bit of the flags is used
+	sc, err = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-02")
+	require.NoError(t, err)
+	assert.False(t, sc.Sampled)
+
+	// Test: Later versions may add fields
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.NoError(t, err)
+
+	// Test: Invalid headers
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		_, err := ParseTraceparent(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tracer := &Tracer{}
+
+	// Test: Extract reads both headers
+	h := headers.NewHeaders()
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set("tracestate", "vendor=abc")
+	parent := Extract(h)
+	require.True(t, parent.IsValid())
+	assert.Equal(t, "vendor=abc", parent.TraceState)
+
+	// Test: A child continues the trace with a new span ID
+	ctx, span := tracer.Start(context.Background(), "GET", SpanKindServer, parent)
+	assert.Equal(t, parent.TraceID, span.Context.TraceID)
+	assert.Equal(t, parent.SpanID, span.Parent)
+	assert.NotEqual(t, parent.SpanID, span.Context.SpanID)
+	assert.Same(t, span, SpanFromContext(ctx))
+
+	// Test: Inject writes the span in the context
+	_, child := StartChild(ctx, "GET", SpanKindClient)
+	out := headers.NewHeaders()
+	Inject(ContextWithSpan(ctx, child), out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+child.Context.SpanID.String()+"-01", out.Get("traceparent"))
+	assert.Equal(t, "vendor=abc", out.Get("tracestate"))
+
+	// Test: Without a parent a new sampled trace is started
+	_, root := tracer.Start(context.Background(), "GET", SpanKindServer, Extract(headers.NewHeaders()))
+	assert.True(t, root.Context.IsValid())
+	assert.True(t, root.Context.Sampled)
+	assert.False(t, root.Parent.IsValid())
+
+	// Test: Outside of a trace nothing is started or injected
+	ctx, span = StartChild(context.Background(), "GET", SpanKindClient)
+	assert.Nil(t, span)
+	span.SetAttribute("ignored", 1)
+	span.Finish()
+	Inject(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+child.Context.SpanID.String()+"-01", out.Get("traceparent"))
+}
+
+func TestTracerExport(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]*Span
+	tracer := &Tracer{
+		Exporter: ExporterFunc(func(ctx context.Context, spans []*Span) error {
+			mu.Lock()
+			defer mu.Unlock()
+			batches = append(batches, spans)
+			return nil
+		}),
+		BatchSize:     2,
+		BatchInterval: time.Hour,
+	}
+	exported := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, batch := range batches {
+			n += len(batch)
+		}
+		return n
+	}
+
+	// Test: A full batch is exported right away
+	for range 2 {
+		_, span := tracer.Start(context.Background(), "GET", SpanKindServer, SpanContext{})
+		span.SetAttribute("http.response.status_code", 200)
+		span.SetAttribute("http.response.status_code", 404)
+		span.Finish()
+		span.Finish()
+	}
+	assert.Eventually(t, func() bool { return exported() == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []Attribute{{Key: "http.response.status_code", Value: 404}}, batches[0][0].Attributes)
+	assert.False(t, batches[0][0].End.IsZero())
+
+	// Test: Spans that aren't sampled aren't exported
+	parent := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{1}}
+	_, span := tracer.Start(context.Background(), "GET", SpanKindServer, parent)
+	span.Finish()
+
+	// Test: Close exports what's left and drops later spans
+	_, span = tracer.Start(context.Background(), "GET", SpanKindServer, SpanContext{})
+	span.Finish()
+	require.NoError(t, tracer.Close(context.Background()))
+	assert.Equal(t, 3, exported())
+	_, span = tracer.Start(context.Background(), "GET", SpanKindServer, SpanContext{})
+	span.Finish()
+	assert.Equal(t, int64(1), tracer.Dropped())
+}